@@ -1,21 +1,229 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"gopkg.in/yaml.v3"
 	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 )
 
+const (
+	ObjectClassRelease = "release"
+	ObjectClassIndex   = "index"
+	ObjectClassByHash  = "by_hash"
+	ObjectClassPool    = "pool"
+)
+
+const (
+	SignatureCheckFail = "fail"
+	SignatureCheckWarn = "warn"
+)
+
+const (
+	SignerKey     = "key"
+	SignerGPG     = "gpg"
+	SignerCommand = "command"
+	SignerSocket  = "socket"
+)
+
+type ObjectPolicy struct {
+	ContentType  string `yaml:"content_type"`
+	CacheControl string `yaml:"cache_control"`
+}
+
+type DebugConfig struct {
+	Suite     string `yaml:"suite"`
+	Component string `yaml:"component"`
+}
+
+type SigningKey struct {
+	PrivateKey     string `yaml:"private_key"`
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"`
+	Passkey        string `yaml:"passkey"`
+	PasskeyFile    string `yaml:"passkey_file,omitempty"`
+	KeyID          string `yaml:"key_id"`
+}
+
+// SignerConfig selects how Release files are signed: in-process with the
+// configured private keys (the default), through gpg and its agent, by an
+// external command or by a service listening on a Unix socket. Hash and Time
+// apply to every signer; Time is "now", "source_date_epoch" or an RFC 3339
+// timestamp. A pinned Time is meant for reproducible builds: it dates the
+// Release as well as the signatures, so it can't be combined with valid_for.
+type SignerConfig struct {
+	Type       string   `yaml:"type"`
+	GPGBinary  string   `yaml:"gpg_binary"`
+	GPGHomedir string   `yaml:"gpg_homedir"`
+	KeyIDs     []string `yaml:"key_ids"`
+	Command    []string `yaml:"command"`
+	Socket     string   `yaml:"socket"`
+
+	// PublicKey holds the public keys of a command or socket signer, which
+	// can't be asked for them, to verify and publish its signatures with.
+	PublicKey     string `yaml:"public_key"`
+	PublicKeyFile string `yaml:"public_key_file"`
+
+	Hash string `yaml:"hash"`
+	Time string `yaml:"time"`
+}
+
+// SuiteConfig overrides signing and publishing settings for one repository.
+// Signing is picked from Signer, then SigningKeys, then the configured keys
+// matching KeyIDs, falling back to the global signer. Compression lists the
+// extra index variants (.gz, .xz) published next to the uncompressed ones and
+// RetainVersions, when positive, prunes older versions of every package.
+type SuiteConfig struct {
+	KeyIDs         []string          `yaml:"key_ids,omitempty"`
+	SigningKeys    []SigningKey      `yaml:"signing_keys,omitempty"`
+	Signer         *SignerConfig     `yaml:"signer,omitempty"`
+	Compression    []string          `yaml:"compression,omitempty"`
+	RetainVersions *int              `yaml:"retain_versions,omitempty"`
+	ReleaseFields  map[string]string `yaml:"release_fields,omitempty"`
+}
+
+// Merge returns s with the fields set in o replacing its own.
+func (s SuiteConfig) Merge(o SuiteConfig) SuiteConfig {
+	if o.KeyIDs != nil {
+		s.KeyIDs = o.KeyIDs
+	}
+	if o.SigningKeys != nil {
+		s.SigningKeys = o.SigningKeys
+	}
+	if o.Signer != nil {
+		s.Signer = o.Signer
+	}
+	if o.Compression != nil {
+		s.Compression = o.Compression
+	}
+	if o.RetainVersions != nil {
+		s.RetainVersions = o.RetainVersions
+	}
+	if o.ReleaseFields != nil {
+		s.ReleaseFields = o.ReleaseFields
+	}
+	return s
+}
+
+// RepoConfig declares a repository `faptly repo apply` creates or reconciles,
+// keyed by codename in Config.Repos. Components and architectures are made to
+// match exactly; other fields left out are kept as they are in storage. Suite
+// defaults to the codename when the repository is created. Setting version,
+// changelogs, signed_by or valid_for to "" removes the field from the
+// Release, and false does the same for the flags.
+type RepoConfig struct {
+	Suite         string   `yaml:"suite"`
+	Origin        string   `yaml:"origin"`
+	Label         string   `yaml:"label"`
+	Description   string   `yaml:"description"`
+	Components    []string `yaml:"components"`
+	Architectures []string `yaml:"architectures"`
+
+	Version                     *string `yaml:"version"`
+	Changelogs                  *string `yaml:"changelogs"`
+	SignedBy                    *string `yaml:"signed_by"`
+	ValidFor                    *string `yaml:"valid_for"`
+	NotAutomatic                *bool   `yaml:"not_automatic"`
+	ButAutomaticUpgrades        *bool   `yaml:"but_automatic_upgrades"`
+	AcquireByHash               *bool   `yaml:"acquire_by_hash"`
+	NoSupportForArchitectureAll *bool   `yaml:"no_support_for_architecture_all"`
+}
+
+// Profile holds the storage and signing settings of one deployment target,
+// e.g. dev, staging or prod. Settings set in the profile replace the ones at
+// the top level of the config, a secret given either inline or through its
+// *_file variant replacing both. Suites, repos and publishing settings are
+// global.
+type Profile struct {
+	FSRoot            string `yaml:"fs_root"`
+	S3Endpoint        string `yaml:"s3_endpoint"`
+	S3Bucket          string `yaml:"s3_bucket"`
+	S3Prefix          string `yaml:"s3_prefix"`
+	S3AccessKey       string `yaml:"s3_access_key"`
+	S3SecretKey       string `yaml:"s3_secret_key"`
+	PrivateGPGKey     string `yaml:"private_gpg_key"`
+	PrivateGPGPasskey string `yaml:"private_gpg_passkey"`
+	PrivateGPGKeyID   string `yaml:"private_gpg_key_id"`
+
+	S3AccessKeyFile       string `yaml:"s3_access_key_file"`
+	S3SecretKeyFile       string `yaml:"s3_secret_key_file"`
+	PrivateGPGKeyFile     string `yaml:"private_gpg_key_file"`
+	PrivateGPGPasskeyFile string `yaml:"private_gpg_passkey_file"`
+
+	SigningKeys      []SigningKey  `yaml:"signing_keys"`
+	Signer           *SignerConfig `yaml:"signer"`
+	PublicGPGKey     string        `yaml:"public_gpg_key"`
+	PublicGPGKeyFile string        `yaml:"public_gpg_key_file"`
+}
+
 type Config struct {
+	FSRoot            string `yaml:"fs_root"`
 	S3Endpoint        string `yaml:"s3_endpoint"`
 	S3Bucket          string `yaml:"s3_bucket"`
+	S3Prefix          string `yaml:"s3_prefix"`
 	S3AccessKey       string `yaml:"s3_access_key"`
 	S3SecretKey       string `yaml:"s3_secret_key"`
 	PrivateGPGKey     string `yaml:"private_gpg_key"`
 	PrivateGPGPasskey string `yaml:"private_gpg_passkey"`
+	PrivateGPGKeyID   string `yaml:"private_gpg_key_id"`
+
+	// The *_file variants read the secret from a file instead, relative
+	// paths being resolved against the directory of the config file.
+	S3AccessKeyFile       string `yaml:"s3_access_key_file"`
+	S3SecretKeyFile       string `yaml:"s3_secret_key_file"`
+	PrivateGPGKeyFile     string `yaml:"private_gpg_key_file"`
+	PrivateGPGPasskeyFile string `yaml:"private_gpg_passkey_file"`
+
+	// SigningKeys sign every Release alongside the private GPG key, e.g.
+	// while rotating from an old key to a new one.
+	SigningKeys []SigningKey `yaml:"signing_keys"`
+
+	Signer SignerConfig `yaml:"signer"`
+
+	// PublicGPGKey holds extra armored public keys InRelease signatures are
+	// verified with, besides the keys of the signer. SignatureCheck is
+	// "fail" (the default) or "warn".
+	PublicGPGKey     string `yaml:"public_gpg_key"`
+	PublicGPGKeyFile string `yaml:"public_gpg_key_file"`
+	SignatureCheck   string `yaml:"signature_check"`
+
+	// Suites holds per-repository settings keyed by codename.
+	Suites map[string]SuiteConfig `yaml:"suites"`
+
+	// Profiles holds named deployment targets selected with --profile.
+	Profiles map[string]Profile `yaml:"profiles"`
+
+	// Repos declares repositories for `faptly repo apply`, keyed by codename.
+	Repos map[string]RepoConfig `yaml:"repos"`
+
+	SplitDescriptions bool        `yaml:"split_descriptions"`
+	Debug             DebugConfig `yaml:"debug"`
+
+	ObjectPolicies   map[string]ObjectPolicy `yaml:"object_policies"`
+	ObjectMetadata   map[string]string       `yaml:"object_metadata"`
+	ChecksumMetadata bool                    `yaml:"checksum_metadata"`
+
+	path string
+}
+
+// Pool objects are immutable too: uploads refuse to replace a package file
+// with different contents under the same name.
+var defaultObjectPolicies = map[string]ObjectPolicy{
+	ObjectClassRelease: {CacheControl: "public, max-age=60"},
+	ObjectClassIndex:   {CacheControl: "public, max-age=300"},
+	ObjectClassByHash:  {CacheControl: "public, max-age=31536000, immutable"},
+	ObjectClassPool:    {CacheControl: "public, max-age=31536000, immutable"},
 }
 
 func New() *Config {
-	return &Config{}
+	policies := make(map[string]ObjectPolicy, len(defaultObjectPolicies))
+	for class, policy := range defaultObjectPolicies {
+		policies[class] = policy
+	}
+	return &Config{ObjectPolicies: policies}
 }
 
 func (c *Config) Load(path string) error {
@@ -28,9 +236,122 @@ func (c *Config) Load(path string) error {
 		return err
 	}
 
+	// A class listed in the file replaces the whole default policy, so fill
+	// in the fields it leaves out.
+	for class, policy := range c.ObjectPolicies {
+		if policy.CacheControl == "" {
+			policy.CacheControl = defaultObjectPolicies[class].CacheControl
+		}
+		if policy.ContentType == "" {
+			policy.ContentType = defaultObjectPolicies[class].ContentType
+		}
+		c.ObjectPolicies[class] = policy
+	}
+
+	c.path = path
 	return nil
 }
 
-func (c *Config) Validate() error {
+// Resolve expands ${NAME} references to environment variables in the loaded
+// settings and reads the secrets given through *_file settings. It is called
+// once the profile is picked, so that only the profile in use has to resolve.
+func (c *Config) Resolve() error {
+	var errs []error
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() || field.Name == "Profiles" {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		errs = append(errs, expandValues(v.Field(i), key)...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return c.wrap(err)
+	}
+
+	return c.wrap(c.readSecretFiles(filepath.Dir(c.path)))
+}
+
+func (c *Config) wrap(err error) error {
+	if err == nil || c.path == "" {
+		return err
+	}
+	return fmt.Errorf("%s: %w", c.path, err)
+}
+
+// Keys returns the private GPG key followed by the additional signing keys.
+func (c *Config) Keys() []SigningKey {
+	var keys []SigningKey
+	if c.PrivateGPGKey != "" {
+		keys = append(keys, SigningKey{
+			PrivateKey: c.PrivateGPGKey,
+			Passkey:    c.PrivateGPGPasskey,
+			KeyID:      c.PrivateGPGKeyID,
+		})
+	}
+	return append(keys, c.SigningKeys...)
+}
+
+// UseProfile applies the settings of the named profile, before Resolve. A
+// profile storing on the filesystem drops the S3 settings of the top level
+// and vice versa.
+func (c *Config) UseProfile(name string) error {
+	p, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("profile %s not found, no profiles are configured", name)
+		}
+		return fmt.Errorf("profile %s not found, available profiles: %s", name, strings.Join(names, ", "))
+	}
+
+	if p.FSRoot != "" {
+		c.S3Endpoint, c.S3Bucket = "", ""
+	}
+	if p.S3Endpoint != "" || p.S3Bucket != "" {
+		c.FSRoot = ""
+	}
+
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{p.FSRoot, &c.FSRoot},
+		{p.S3Endpoint, &c.S3Endpoint},
+		{p.S3Bucket, &c.S3Bucket},
+		{p.S3Prefix, &c.S3Prefix},
+		{p.PrivateGPGKeyID, &c.PrivateGPGKeyID},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+
+	for _, secret := range []struct {
+		value, file        string
+		target, fileTarget *string
+	}{
+		{p.S3AccessKey, p.S3AccessKeyFile, &c.S3AccessKey, &c.S3AccessKeyFile},
+		{p.S3SecretKey, p.S3SecretKeyFile, &c.S3SecretKey, &c.S3SecretKeyFile},
+		{p.PrivateGPGKey, p.PrivateGPGKeyFile, &c.PrivateGPGKey, &c.PrivateGPGKeyFile},
+		{p.PrivateGPGPasskey, p.PrivateGPGPasskeyFile, &c.PrivateGPGPasskey, &c.PrivateGPGPasskeyFile},
+		{p.PublicGPGKey, p.PublicGPGKeyFile, &c.PublicGPGKey, &c.PublicGPGKeyFile},
+	} {
+		if secret.value != "" || secret.file != "" {
+			*secret.target, *secret.fileTarget = secret.value, secret.file
+		}
+	}
+
+	if p.SigningKeys != nil {
+		c.SigningKeys = p.SigningKeys
+	}
+	if p.Signer != nil {
+		c.Signer = *p.Signer
+	}
 	return nil
 }
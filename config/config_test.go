@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func loadConfig(t *testing.T, data string) *Config {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "faptly.yaml")
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New()
+	if err := c.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+const profilesConfig = `
+s3_endpoint: https://s3.example.com
+s3_bucket: packages
+s3_access_key: top-access
+private_gpg_key: top-key
+private_gpg_passkey: top-pass
+suites:
+  trixie:
+    compression: [gz]
+profiles:
+  dev:
+    fs_root: ${FAPTLY_TEST_ROOT}
+  prod:
+    s3_bucket: prod-packages
+    s3_access_key_file: ${FAPTLY_TEST_SECRETS}/access
+    private_gpg_key: ${FAPTLY_TEST_PROD_KEY}
+    public_gpg_key: old and new keys
+    signing_keys:
+      - private_key: next-key
+    signer:
+      type: command
+      command: [sign, --key, "${FAPTLY_TEST_PROD_KEY}"]
+      public_key: signer public key
+`
+
+func TestUseProfile(t *testing.T) {
+	secrets := t.TempDir()
+	if err := os.WriteFile(filepath.Join(secrets, "access"), []byte("prod-access\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("filesystem", func(t *testing.T) {
+		t.Setenv("FAPTLY_TEST_ROOT", "/srv/dev")
+
+		c := loadConfig(t, profilesConfig)
+		if err := c.UseProfile("dev"); err != nil {
+			t.Fatal(err)
+		}
+		// The prod profile references variables that aren't set.
+		if err := c.Resolve(); err != nil {
+			t.Fatal(err)
+		}
+
+		if c.FSRoot != "/srv/dev" || c.S3Endpoint != "" || c.S3Bucket != "" {
+			t.Errorf("storage = %q, %q, %q, want the fs_root of the profile only", c.FSRoot, c.S3Endpoint, c.S3Bucket)
+		}
+		if c.PrivateGPGKey != "top-key" || c.PrivateGPGPasskey != "top-pass" {
+			t.Errorf("keys = %q, %q, want the top-level ones", c.PrivateGPGKey, c.PrivateGPGPasskey)
+		}
+		if c.Suites["trixie"].Compression == nil {
+			t.Error("suites are dropped by the profile")
+		}
+	})
+
+	t.Run("s3 and signing", func(t *testing.T) {
+		t.Setenv("FAPTLY_TEST_SECRETS", secrets)
+		t.Setenv("FAPTLY_TEST_PROD_KEY", "prod-key")
+
+		c := loadConfig(t, profilesConfig)
+		if err := c.UseProfile("prod"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Resolve(); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, field := range []struct {
+			name, got, want string
+		}{
+			{"s3_endpoint", c.S3Endpoint, "https://s3.example.com"},
+			{"s3_bucket", c.S3Bucket, "prod-packages"},
+			{"s3_access_key", c.S3AccessKey, "prod-access"},
+			{"private_gpg_key", c.PrivateGPGKey, "prod-key"},
+			{"private_gpg_passkey", c.PrivateGPGPasskey, "top-pass"},
+			{"public_gpg_key", c.PublicGPGKey, "old and new keys"},
+			{"signer.type", c.Signer.Type, SignerCommand},
+			{"signer.public_key", c.Signer.PublicKey, "signer public key"},
+		} {
+			if field.got != field.want {
+				t.Errorf("%s = %q, want %q", field.name, field.got, field.want)
+			}
+		}
+		if !slices.Equal(c.Signer.Command, []string{"sign", "--key", "prod-key"}) {
+			t.Errorf("signer.command = %q, want the variable expanded", c.Signer.Command)
+		}
+		if len(c.SigningKeys) != 1 || c.SigningKeys[0].PrivateKey != "next-key" {
+			t.Errorf("signing_keys = %+v, want the profile's", c.SigningKeys)
+		}
+	})
+
+	t.Run("unset variable", func(t *testing.T) {
+		c := loadConfig(t, profilesConfig)
+		if err := c.UseProfile("prod"); err != nil {
+			t.Fatal(err)
+		}
+		err := c.Resolve()
+		if err == nil || !strings.Contains(err.Error(), "s3_access_key_file: undefined environment variables: FAPTLY_TEST_SECRETS") {
+			t.Errorf("Resolve() error = %v, want the unset variable named after its setting", err)
+		}
+	})
+
+	t.Run("unknown profile", func(t *testing.T) {
+		c := loadConfig(t, profilesConfig)
+		err := c.UseProfile("staging")
+		if err == nil || !strings.Contains(err.Error(), "available profiles: dev, prod") {
+			t.Errorf("UseProfile() error = %v, want the available profiles listed", err)
+		}
+	})
+}
+
+func TestResolveExpandsDecodedValues(t *testing.T) {
+	// A value with YAML syntax in it must not change the document structure.
+	t.Setenv("FAPTLY_TEST_PREFIX", "a: b\n- c")
+
+	c := loadConfig(t, "fs_root: /srv\ns3_prefix: ${FAPTLY_TEST_PREFIX}\nobject_metadata:\n  owner: ${FAPTLY_TEST_PREFIX}\n")
+	if err := c.Resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if c.S3Prefix != "a: b\n- c" || c.ObjectMetadata["owner"] != "a: b\n- c" {
+		t.Errorf("s3_prefix = %q, object_metadata.owner = %q, want the raw variable", c.S3Prefix, c.ObjectMetadata["owner"])
+	}
+}
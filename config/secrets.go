@@ -0,0 +1,133 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} with the value of the environment variable NAME,
+// failing on unset variables. Any other $ is kept as it is.
+func expandEnv(s string) (string, error) {
+	var missing []string
+
+	s = envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		name := ref[2 : len(ref)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+
+	if len(missing) != 0 {
+		return "", fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return s, nil
+}
+
+// expandValues runs expandEnv over every string reachable from v, naming the
+// settings that fail after their YAML keys. Map keys are left as they are.
+func expandValues(v reflect.Value, name string) []error {
+	switch v.Kind() {
+	case reflect.String:
+		s, err := expandEnv(v.String())
+		if err != nil {
+			return []error{fmt.Errorf("%s: %w", name, err)}
+		}
+		v.SetString(s)
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return expandValues(v.Elem(), name)
+		}
+	case reflect.Struct:
+		var errs []error
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name != "" {
+				key = name + "." + key
+			}
+			errs = append(errs, expandValues(v.Field(i), key)...)
+		}
+		return errs
+	case reflect.Slice:
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, expandValues(v.Index(i), fmt.Sprintf("%s[%d]", name, i))...)
+		}
+		return errs
+	case reflect.Map:
+		var errs []error
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			errs = append(errs, expandValues(value, fmt.Sprintf("%s.%v", name, iter.Key()))...)
+			v.SetMapIndex(iter.Key(), value)
+		}
+		return errs
+	}
+	return nil
+}
+
+// readSecretFiles loads every secret given through a *_file setting.
+func (c *Config) readSecretFiles(dir string) error {
+	var errs []error
+
+	read := func(name string, value *string, file string, trim bool) {
+		if file == "" {
+			return
+		}
+		if *value != "" {
+			errs = append(errs, fmt.Errorf("%s and %s_file are mutually exclusive", name, name))
+			return
+		}
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s_file: %w", name, err))
+			return
+		}
+		*value = string(data)
+		if trim {
+			*value = strings.TrimRight(*value, "\r\n")
+		}
+	}
+
+	read("s3_access_key", &c.S3AccessKey, c.S3AccessKeyFile, true)
+	read("s3_secret_key", &c.S3SecretKey, c.S3SecretKeyFile, true)
+	read("private_gpg_key", &c.PrivateGPGKey, c.PrivateGPGKeyFile, false)
+	read("private_gpg_passkey", &c.PrivateGPGPasskey, c.PrivateGPGPasskeyFile, true)
+	read("public_gpg_key", &c.PublicGPGKey, c.PublicGPGKeyFile, false)
+	read("signer.public_key", &c.Signer.PublicKey, c.Signer.PublicKeyFile, false)
+
+	readKeys := func(prefix string, keys []SigningKey) {
+		for i := range keys {
+			name := fmt.Sprintf("%ssigning_keys[%d].", prefix, i)
+			read(name+"private_key", &keys[i].PrivateKey, keys[i].PrivateKeyFile, false)
+			read(name+"passkey", &keys[i].Passkey, keys[i].PasskeyFile, true)
+		}
+	}
+
+	readKeys("", c.SigningKeys)
+	for name, suite := range c.Suites {
+		readKeys("suites."+name+".", suite.SigningKeys)
+		if suite.Signer != nil {
+			read("suites."+name+".signer.public_key", &suite.Signer.PublicKey, suite.Signer.PublicKeyFile, false)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,294 @@
+package config
+
+import (
+	"fmt"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Requirement tells Validate what the command about to run needs.
+type Requirement int
+
+const (
+	NeedStorage Requirement = 1 << iota
+	NeedSigning
+	// NeedRepos checks the repositories declared for repo apply.
+	NeedRepos
+)
+
+// Checks interpret the settings whose format belongs to the packages using
+// them, keeping config free of those dependencies. A nil check is skipped.
+type Checks struct {
+	Endpoint func(endpoint string) error
+	Hash     func(name string) error
+	Time     func(source string) error
+	Keyring  func(keyring string) error
+
+	// Key makes sure a signing key can be decrypted and sign, HasKey that
+	// it holds keyID.
+	Key    func(k SigningKey) error
+	HasKey func(k SigningKey, keyID string) bool
+}
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the settings needed by req along with the format of every
+// setting present, reporting all problems at once.
+func (c *Config) Validate(req Requirement, checks Checks) error {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.FSRoot != "" && (c.S3Endpoint != "" || c.S3Bucket != "") {
+		add("fs_root and s3_endpoint/s3_bucket are mutually exclusive")
+	}
+	if c.S3Endpoint != "" && checks.Endpoint != nil {
+		if err := checks.Endpoint(c.S3Endpoint); err != nil {
+			add("s3_endpoint: %v", err)
+		}
+	}
+	if (c.S3AccessKey == "") != (c.S3SecretKey == "") {
+		add("s3_access_key and s3_secret_key must be set together")
+	}
+	if req&NeedStorage != 0 && c.FSRoot == "" {
+		if c.S3Endpoint == "" {
+			add("s3_endpoint is required (or fs_root for local storage)")
+		}
+		if c.S3Bucket == "" {
+			add("s3_bucket is required (or fs_root for local storage)")
+		}
+	}
+
+	if c.SignatureCheck != "" && c.SignatureCheck != SignatureCheckFail && c.SignatureCheck != SignatureCheckWarn {
+		add("signature_check must be %s or %s, got %q", SignatureCheckFail, SignatureCheckWarn, c.SignatureCheck)
+	}
+	if req&NeedStorage != 0 && c.SignatureCheck != SignatureCheckWarn && !c.canVerify() {
+		add("no public keys to verify repository signatures with: set public_gpg_key, signing keys or signer.public_key, or signature_check: %s", SignatureCheckWarn)
+	}
+	if c.Debug.Suite != "" && c.Debug.Component == "" {
+		add("debug.component is required with debug.suite")
+	}
+	for class := range c.ObjectPolicies {
+		if !slices.Contains([]string{ObjectClassRelease, ObjectClassIndex, ObjectClassByHash, ObjectClassPool}, class) {
+			add("object_policies: unknown object class %q", class)
+		}
+	}
+
+	for _, problem := range c.Signer.validate(req&NeedSigning != 0, checks) {
+		add("signer: %s", problem)
+	}
+	if req&NeedSigning != 0 {
+		problems = append(problems, c.validateKeys("", c.Signer, c.Keys(), checks)...)
+	}
+
+	names := make([]string, 0, len(c.Suites))
+	for name := range c.Suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		suite := c.Suites[name]
+		signer := c.Signer
+		if suite.Signer != nil {
+			signer = *suite.Signer
+			for _, problem := range signer.validate(req&NeedSigning != 0, checks) {
+				add("suites.%s.signer: %s", name, problem)
+			}
+		}
+		for _, ext := range suite.Compression {
+			if ext != "" && ext != ".gz" && ext != ".xz" {
+				add("suites.%s.compression: unsupported compression %q", name, ext)
+			}
+		}
+		if suite.RetainVersions != nil && *suite.RetainVersions < 0 {
+			add("suites.%s.retain_versions must not be negative", name)
+		}
+
+		if req&NeedSigning == 0 {
+			continue
+		}
+		if len(suite.SigningKeys) != 0 {
+			problems = append(problems, c.validateKeys("suites."+name+".", signer, suite.SigningKeys, checks)...)
+		}
+		for _, id := range suite.KeyIDs {
+			if checks.HasKey == nil {
+				break
+			}
+			if !slices.ContainsFunc(c.Keys(), func(k SigningKey) bool { return checks.HasKey(k, id) }) {
+				add("suites.%s.key_ids: key %s not found in the configured keys", name, id)
+			}
+		}
+	}
+
+	names = names[:0]
+	if req&NeedRepos != 0 {
+		for name := range c.Repos {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		repo := c.Repos[name]
+		if len(repo.Components) == 0 {
+			add("repos.%s.components is required", name)
+		}
+		if len(repo.Architectures) == 0 {
+			add("repos.%s.architectures is required", name)
+		}
+		if repo.ValidFor != nil && *repo.ValidFor != "" {
+			d, err := time.ParseDuration(*repo.ValidFor)
+			if err != nil {
+				add("repos.%s.valid_for: %v", name, err)
+			}
+
+			signer := c.Signer
+			if suite, ok := c.Suites[name]; ok && suite.Signer != nil {
+				signer = *suite.Signer
+			}
+			if d > 0 && signer.Time != "" && signer.Time != "now" {
+				add("repos.%s.valid_for can't be combined with the pinned signer time %s", name, signer.Time)
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (s SignerConfig) validate(signing bool, checks Checks) []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if checks.Hash != nil {
+		if err := checks.Hash(s.Hash); err != nil {
+			add("hash: %v", err)
+		}
+	}
+	if checks.Time != nil {
+		if err := checks.Time(s.Time); err != nil {
+			add("time: %v", err)
+		}
+	}
+
+	switch s.Type {
+	case "", SignerKey:
+	case SignerGPG:
+		binary := s.GPGBinary
+		if binary == "" {
+			binary = "gpg"
+		}
+		if _, err := exec.LookPath(binary); signing && err != nil {
+			add("gpg_binary: %v", err)
+		}
+	case SignerCommand:
+		if len(s.Command) == 0 {
+			add("command is required with type %s", SignerCommand)
+		}
+	case SignerSocket:
+		if s.Socket == "" {
+			add("socket is required with type %s", SignerSocket)
+		}
+	default:
+		add("unknown type %q", s.Type)
+	}
+
+	if s.PublicKey != "" {
+		if s.Type != SignerCommand && s.Type != SignerSocket {
+			add("public_key is only used with type %s or %s", SignerCommand, SignerSocket)
+		} else if checks.Keyring != nil {
+			if err := checks.Keyring(s.PublicKey); err != nil {
+				add("public_key: %v", err)
+			}
+		}
+	}
+	return problems
+}
+
+// validateKeys decrypts every key used by an in-process signer, which also
+// makes sure the selected key can sign.
+func (c *Config) validateKeys(prefix string, signer SignerConfig, keys []SigningKey, checks Checks) []string {
+	if signer.Type != "" && signer.Type != SignerKey {
+		return nil
+	}
+
+	if len(keys) == 0 {
+		if prefix == "" && c.suitesSignOwn() {
+			return nil
+		}
+		return []string{prefix + "private_gpg_key or signing_keys is required to sign repositories"}
+	}
+
+	var problems []string
+	for i, k := range keys {
+		name := fmt.Sprintf("%ssigning_keys[%d]", prefix, i)
+		if prefix == "" && c.PrivateGPGKey != "" {
+			name = "private_gpg_key"
+			if i > 0 {
+				name = fmt.Sprintf("signing_keys[%d]", i-1)
+			}
+		}
+
+		if checks.Key == nil {
+			continue
+		}
+		if err := checks.Key(k); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return problems
+}
+
+// canVerify reports whether any setting provides public keys to verify
+// repository signatures with.
+func (c *Config) canVerify() bool {
+	if c.PublicGPGKey != "" || len(c.Keys()) != 0 {
+		return true
+	}
+
+	signers := []SignerConfig{c.Signer}
+	for _, suite := range c.Suites {
+		if len(suite.SigningKeys) != 0 {
+			return true
+		}
+		if suite.Signer != nil {
+			signers = append(signers, *suite.Signer)
+		}
+	}
+	for _, s := range signers {
+		if s.Type == SignerGPG || s.PublicKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// suitesSignOwn reports whether every configured suite brings its own
+// signer, so that no global key is needed.
+func (c *Config) suitesSignOwn() bool {
+	if len(c.Suites) == 0 {
+		return false
+	}
+	for _, suite := range c.Suites {
+		if suite.Signer == nil && len(suite.SigningKeys) == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package config
+
+import "testing"
+
+func TestValidateVerificationKeys(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config Config
+		req    Requirement
+		err    bool
+	}{
+		{name: "nothing to verify with", config: Config{FSRoot: "/srv"}, req: NeedStorage, err: true},
+		{name: "no storage needed", config: Config{}},
+		{name: "public key", config: Config{FSRoot: "/srv", PublicGPGKey: "key"}, req: NeedStorage},
+		{name: "private key", config: Config{FSRoot: "/srv", PrivateGPGKey: "key"}, req: NeedStorage},
+		{name: "gpg signer", config: Config{FSRoot: "/srv", Signer: SignerConfig{Type: SignerGPG}}, req: NeedStorage},
+		{name: "command signer", config: Config{FSRoot: "/srv", Signer: SignerConfig{Type: SignerCommand, Command: []string{"sign"}}}, req: NeedStorage, err: true},
+		{name: "command signer with public key", config: Config{FSRoot: "/srv", Signer: SignerConfig{Type: SignerCommand, Command: []string{"sign"}, PublicKey: "key"}}, req: NeedStorage},
+		{name: "warn", config: Config{FSRoot: "/srv", SignatureCheck: SignatureCheckWarn}, req: NeedStorage},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// The checks are left out, only whether a source of public keys
+			// is configured matters here.
+			err := tt.config.Validate(tt.req, Checks{})
+			if (err != nil) != tt.err {
+				t.Errorf("Validate() error = %v, want error %t", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateReposOnlyForApply(t *testing.T) {
+	bad := "soon"
+	c := Config{
+		FSRoot:       "/srv",
+		PublicGPGKey: "key",
+		Repos:        map[string]RepoConfig{"trixie": {ValidFor: &bad}},
+	}
+
+	if err := c.Validate(NeedStorage, Checks{}); err != nil {
+		t.Errorf("Validate(NeedStorage) = %v, want repos ignored", err)
+	}
+
+	err := c.Validate(NeedStorage|NeedRepos, Checks{})
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Validate(NeedRepos) = %v, want a ValidationError", err)
+	}
+	if len(verr.Problems) != 3 {
+		t.Errorf("Validate(NeedRepos) problems = %q, want components, architectures and valid_for", verr.Problems)
+	}
+
+	empty := ""
+	c.Repos["trixie"] = RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}, ValidFor: &empty}
+	if err := c.Validate(NeedStorage|NeedRepos, Checks{}); err != nil {
+		t.Errorf("Validate() with an empty valid_for = %v, want nil", err)
+	}
+}
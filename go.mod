@@ -8,6 +8,7 @@ require (
 	github.com/blakesmith/ar v0.0.0-20190502131153-809d4375e1fb
 	github.com/klauspost/compress v1.18.0
 	github.com/minio/minio-go/v7 v7.0.94
+	github.com/ulikunitz/xz v0.5.9
 	github.com/urfave/cli/v3 v3.3.8
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8
 	golang.org/x/sync v0.15.0
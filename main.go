@@ -1,12 +1,21 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"github.com/akozlenkov/faptly/config"
 	"github.com/akozlenkov/faptly/manager"
+	"github.com/akozlenkov/faptly/pgp"
+	"github.com/akozlenkov/go-debian/control"
 	"github.com/urfave/cli/v3"
+	"gopkg.in/yaml.v3"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func main() {
@@ -19,6 +28,16 @@ func main() {
 				Usage:   "Load config from `FILE`",
 				Sources: cli.EnvVars("FAPTLY_CONFIG"),
 			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Use the storage and signing settings of profile `NAME` from the config",
+				Sources: cli.EnvVars("FAPTLY_PROFILE"),
+			},
+			&cli.StringFlag{
+				Name:    "fs_root",
+				Usage:   "Store repositories on the local filesystem under `DIR` instead of S3",
+				Sources: cli.EnvVars("FAPTLY_FS_ROOT"),
+			},
 			&cli.StringFlag{
 				Name:    "s3_endpoint",
 				Usage:   "S3 endpoint URL",
@@ -29,6 +48,11 @@ func main() {
 				Usage:   "S3 bucket name",
 				Sources: cli.EnvVars("FAPTLY_S3_BUCKET"),
 			},
+			&cli.StringFlag{
+				Name:    "s3_prefix",
+				Usage:   "S3 key prefix for all repository objects",
+				Sources: cli.EnvVars("FAPTLY_S3_PREFIX"),
+			},
 			&cli.StringFlag{
 				Name:    "s3_access_key",
 				Usage:   "S3 access key",
@@ -49,6 +73,21 @@ func main() {
 				Usage:   "Private GPG passkey",
 				Sources: cli.EnvVars("FAPTLY_PRIVATE_GPG_PASSKEY"),
 			},
+			&cli.StringFlag{
+				Name:    "public_gpg_key",
+				Usage:   "Also verify repository signatures with the public keys in `FILE`",
+				Sources: cli.EnvVars("FAPTLY_PUBLIC_GPG_KEY"),
+			},
+			&cli.StringFlag{
+				Name:    "signature_check",
+				Usage:   "Fail or warn when a repository signature doesn't verify",
+				Sources: cli.EnvVars("FAPTLY_SIGNATURE_CHECK"),
+			},
+			&cli.StringFlag{
+				Name:    "private_gpg_key_id",
+				Usage:   "Sign with the key or subkey matching `FINGERPRINT` (or key ID) in the private GPG key",
+				Sources: cli.EnvVars("FAPTLY_PRIVATE_GPG_KEY_ID"),
+			},
 		},
 		Before: func(ctx context.Context, command *cli.Command) (context.Context, error) {
 			cfg := config.New()
@@ -59,25 +98,47 @@ func main() {
 				}
 			}
 
+			if command.String("profile") != "" {
+				if err := cfg.UseProfile(command.String("profile")); err != nil {
+					return ctx, err
+				}
+			}
+
+			if err := cfg.Resolve(); err != nil {
+				return ctx, err
+			}
+
 			for _, k := range []string{
+				"fs_root",
 				"s3_endpoint",
 				"s3_bucket",
+				"s3_prefix",
 				"s3_access_key",
 				"s3_secret_key",
 				"private_gpg_passkey",
+				"private_gpg_key_id",
+				"signature_check",
 			} {
 				if command.String(k) != "" {
 					switch k {
+					case "fs_root":
+						cfg.FSRoot = command.String(k)
 					case "s3_endpoint":
 						cfg.S3Endpoint = command.String(k)
 					case "s3_bucket":
 						cfg.S3Bucket = command.String(k)
+					case "s3_prefix":
+						cfg.S3Prefix = command.String(k)
 					case "s3_access_key":
 						cfg.S3AccessKey = command.String(k)
 					case "s3_secret_key":
 						cfg.S3SecretKey = command.String(k)
 					case "private_gpg_passkey":
 						cfg.PrivateGPGPasskey = command.String(k)
+					case "private_gpg_key_id":
+						cfg.PrivateGPGKeyID = command.String(k)
+					case "signature_check":
+						cfg.SignatureCheck = command.String(k)
 					}
 				}
 			}
@@ -90,7 +151,15 @@ func main() {
 				cfg.PrivateGPGKey = string(f)
 			}
 
-			return context.WithValue(ctx, "config", cfg), cfg.Validate()
+			if command.String("public_gpg_key") != "" {
+				f, err := os.ReadFile(command.String("public_gpg_key"))
+				if err != nil {
+					return ctx, err
+				}
+				cfg.PublicGPGKey = string(f)
+			}
+
+			return context.WithValue(ctx, "config", cfg), nil
 		},
 		Commands: []*cli.Command{
 			{
@@ -114,15 +183,20 @@ func main() {
 							},
 						},
 						Action: func(ctx context.Context, command *cli.Command) error {
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage)
 							if err != nil {
 								return err
 							}
-							return mgr.ListPkgs(
+							indexes, err := mgr.ListPkgs(
 								command.String("suite"),
 								command.String("component"),
 								command.String("architecture"),
 							)
+							if err != nil {
+								return err
+							}
+							printPkgs(indexes)
+							return nil
 						},
 					},
 					{
@@ -148,16 +222,20 @@ func main() {
 								return cli.ShowSubcommandHelp(command)
 							}
 
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage)
 							if err != nil {
 								return err
 							}
-							return mgr.ShowPkg(
+							index, err := mgr.ShowPkg(
 								command.String("suite"),
 								command.String("component"),
 								command.String("architecture"),
 								command.Args().First(),
 							)
+							if err != nil {
+								return err
+							}
+							return manager.MarshalPackages(os.Stdout, *index)
 						},
 					},
 					{
@@ -174,7 +252,7 @@ func main() {
 							},
 						},
 						Action: func(ctx context.Context, command *cli.Command) error {
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
 							if err != nil {
 								return err
 							}
@@ -194,11 +272,16 @@ func main() {
 						Name:  "list",
 						Usage: "List all available repositories",
 						Action: func(ctx context.Context, command *cli.Command) error {
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage)
+							if err != nil {
+								return err
+							}
+							releases, err := mgr.ListRepos()
 							if err != nil {
 								return err
 							}
-							return mgr.ListRepos()
+							printRepos(releases)
+							return nil
 						},
 					},
 					{
@@ -210,17 +293,21 @@ func main() {
 								return cli.ShowSubcommandHelp(command)
 							}
 
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage)
 							if err != nil {
 								return err
 							}
-							return mgr.ShowRepo(command.Args().First())
+							release, err := mgr.ShowRepo(command.Args().First())
+							if err != nil {
+								return err
+							}
+							return printRepo(release)
 						},
 					},
 					{
 						Name:  "create",
 						Usage: "Create a repository",
-						Flags: []cli.Flag{
+						Flags: append([]cli.Flag{
 							&cli.StringFlag{
 								Name:     "origin",
 								Required: true,
@@ -249,9 +336,9 @@ func main() {
 								Name:     "architecture",
 								Required: true,
 							},
-						},
+						}, releaseFlags()...),
 						Action: func(ctx context.Context, command *cli.Command) error {
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
 							if err != nil {
 								return err
 							}
@@ -263,9 +350,254 @@ func main() {
 								command.String("description"),
 								command.StringSlice("component"),
 								command.StringSlice("architecture"),
+								releaseOptions(command),
 							)
 						},
 					},
+					{
+						Name:      "edit",
+						Usage:     "Edit repository release fields, components and architectures",
+						ArgsUsage: "<suite>",
+						Flags: append([]cli.Flag{
+							&cli.StringFlag{
+								Name: "origin",
+							},
+							&cli.StringFlag{
+								Name: "label",
+							},
+							&cli.StringFlag{
+								Name: "description",
+							},
+							&cli.StringSliceFlag{
+								Name: "add-component",
+							},
+							&cli.StringSliceFlag{
+								Name: "remove-component",
+							},
+							&cli.StringSliceFlag{
+								Name: "add-architecture",
+							},
+							&cli.StringSliceFlag{
+								Name: "remove-architecture",
+							},
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: "Don't ask for confirmation before removing components or architectures",
+							},
+						}, releaseFlags()...),
+						Action: func(ctx context.Context, command *cli.Command) error {
+							if command.Args().Len() == 0 {
+								return cli.ShowSubcommandHelp(command)
+							}
+
+							changes := manager.RepoChanges{
+								AddComponents:       command.StringSlice("add-component"),
+								RemoveComponents:    command.StringSlice("remove-component"),
+								AddArchitectures:    command.StringSlice("add-architecture"),
+								RemoveArchitectures: command.StringSlice("remove-architecture"),
+							}
+
+							if !command.Bool("yes") && len(changes.RemoveComponents)+len(changes.RemoveArchitectures) != 0 {
+								if !confirm(fmt.Sprintf(
+									"Remove components [%s] and architectures [%s] with all their packages from %s?",
+									strings.Join(changes.RemoveComponents, ", "),
+									strings.Join(changes.RemoveArchitectures, ", "),
+									command.Args().First(),
+								)) {
+									return fmt.Errorf("aborted")
+								}
+							}
+
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
+							if err != nil {
+								return err
+							}
+							return mgr.EditRepo(command.Args().First(), releaseOptions(command), changes)
+						},
+					},
+					{
+						Name:      "suite",
+						Usage:     "Point a suite alias such as stable at a codename",
+						ArgsUsage: "<suite> <codename>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "previous",
+								Usage: "New suite for the codename that held the alias until now, e.g. oldstable",
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							if command.Args().Len() != 2 {
+								return cli.ShowSubcommandHelp(command)
+							}
+
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
+							if err != nil {
+								return err
+							}
+							return mgr.PointSuite(command.Args().Get(0), command.Args().Get(1), command.String("previous"))
+						},
+					},
+					{
+						Name:      "settings",
+						Usage:     "Show or change per-repository settings stored in the repository metadata object",
+						ArgsUsage: "<suite>",
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:  "key-id",
+								Usage: "Sign with the configured keys matching `FINGERPRINT`",
+							},
+							&cli.StringSliceFlag{
+								Name:  "compression",
+								Usage: "Publish indices also compressed with `EXT` (.gz, .xz)",
+							},
+							&cli.IntFlag{
+								Name:  "retain-versions",
+								Usage: "Keep only the `N` newest versions of every package, 0 to keep all",
+							},
+							&cli.StringSliceFlag{
+								Name:  "release-field",
+								Usage: "Add `FIELD=VALUE` to the Release file",
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							if command.Args().Len() == 0 {
+								return cli.ShowSubcommandHelp(command)
+							}
+
+							var (
+								changes config.SuiteConfig
+								changed bool
+							)
+							if command.IsSet("key-id") {
+								changes.KeyIDs, changed = command.StringSlice("key-id"), true
+							}
+							if command.IsSet("compression") {
+								changes.Compression, changed = command.StringSlice("compression"), true
+							}
+							if command.IsSet("retain-versions") {
+								n := int(command.Int("retain-versions"))
+								changes.RetainVersions, changed = &n, true
+							}
+							if command.IsSet("release-field") {
+								changes.ReleaseFields, changed = make(map[string]string), true
+								for _, field := range command.StringSlice("release-field") {
+									name, value, ok := strings.Cut(field, "=")
+									if !ok {
+										return fmt.Errorf("invalid release field %q, expected FIELD=VALUE", field)
+									}
+									changes.ReleaseFields[name] = value
+								}
+							}
+
+							if !changed {
+								mgr, err := newManager(ctx, config.NeedStorage)
+								if err != nil {
+									return err
+								}
+								settings, err := mgr.RepoSettings(command.Args().First())
+								if err != nil {
+									return err
+								}
+								return yaml.NewEncoder(os.Stdout).Encode(settings)
+							}
+
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
+							if err != nil {
+								return err
+							}
+							return mgr.UpdateRepoSettings(command.Args().First(), changes)
+						},
+					},
+					{
+						Name:  "apply",
+						Usage: "Create or reconcile the repositories declared under repos in the config",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "Only show the plan",
+							},
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: "Apply the plan without asking for confirmation",
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							cfg := ctx.Value("config").(*config.Config)
+							if len(cfg.Repos) == 0 {
+								return fmt.Errorf("no repositories declared under repos in the config")
+							}
+
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning|config.NeedRepos)
+							if err != nil {
+								return err
+							}
+
+							plans, err := mgr.PlanRepos(cfg.Repos)
+							if err != nil {
+								return err
+							}
+
+							var (
+								pending     []manager.RepoPlan
+								destructive bool
+							)
+							sb := new(strings.Builder)
+							for _, plan := range plans {
+								if plan.Empty() {
+									continue
+								}
+								pending = append(pending, plan)
+								destructive = destructive || plan.Destructive
+
+								if plan.Create {
+									sb.WriteString(fmt.Sprintf(" + %s (create)\n", plan.Codename))
+								} else {
+									sb.WriteString(fmt.Sprintf(" ~ %s\n", plan.Codename))
+								}
+								for _, change := range plan.Changes {
+									sb.WriteString(fmt.Sprintf("     %s\n", change))
+								}
+							}
+
+							if len(pending) == 0 {
+								fmt.Printf("All repositories are up to date.\n")
+								return nil
+							}
+							fmt.Printf("Plan:\n%s", sb.String())
+
+							if command.Bool("dry-run") {
+								return nil
+							}
+							if !command.Bool("yes") {
+								question := "Apply these changes?"
+								if destructive {
+									question = "Apply these changes, removing packages of the dropped components and architectures?"
+								}
+								if !confirm(question) {
+									return fmt.Errorf("aborted")
+								}
+							}
+							return mgr.ApplyRepos(pending)
+						},
+					},
+					{
+						Name:      "resign",
+						Usage:     "Re-sign repositories without rebuilding indices",
+						ArgsUsage: "[<suite>...]",
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "expiring-within",
+								Usage: "Only re-sign repositories whose Valid-Until is closer than `DURATION`",
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							mgr, err := newManager(ctx, config.NeedStorage|config.NeedSigning)
+							if err != nil {
+								return err
+							}
+							return mgr.ResignRepos(command.Args().Slice(), command.Duration("expiring-within"))
+						},
+					},
 					{
 						Name:      "delete",
 						Usage:     "Delete repository",
@@ -275,11 +607,127 @@ func main() {
 								return cli.ShowSubcommandHelp(command)
 							}
 
-							mgr, err := manager.New(ctx.Value("config").(*config.Config))
+							mgr, err := newManager(ctx, config.NeedStorage)
+							if err != nil {
+								return err
+							}
+							removed, err := mgr.DeleteRepo(command.Args().First())
+							if removed != 0 || err == nil {
+								fmt.Printf("Removed %d objects from repository %s\n", removed, command.Args().First())
+							}
+							return err
+						},
+					},
+				},
+			},
+			{
+				Name: "key",
+				Commands: []*cli.Command{
+					{
+						Name:  "generate",
+						Usage: "Generate a repository signing key",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "name",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "email",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:  "type",
+								Usage: "Key type, ed25519 or rsa4096",
+								Value: pgp.KeyTypeEd25519,
+							},
+							&cli.DurationFlag{
+								Name:  "expire",
+								Usage: "Key expires after `DURATION`, 0 for a key that never expires",
+								Value: 2 * 365 * 24 * time.Hour,
+							},
+							&cli.StringFlag{
+								Name:    "passphrase",
+								Usage:   "Encrypt the private key with `PASSPHRASE`",
+								Sources: cli.EnvVars("FAPTLY_KEY_PASSPHRASE"),
+							},
+							&cli.StringFlag{
+								Name:     "output",
+								Usage:    "Write the armored private key to `FILE`",
+								Required: true,
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							key, fingerprint, err := pgp.GenerateKey(
+								command.String("name"),
+								command.String("email"),
+								command.String("type"),
+								command.Duration("expire"),
+								[]byte(command.String("passphrase")),
+							)
+							if err != nil {
+								return err
+							}
+
+							if err := os.WriteFile(command.String("output"), key, 0600); err != nil {
+								return err
+							}
+							fmt.Printf("Generated key %s in %s\n", fingerprint, command.String("output"))
+							return nil
+						},
+					},
+					{
+						Name:  "export",
+						Usage: "Export the public signing keys",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "output",
+								Usage: "Write the armored and binary public keys to `NAME`.asc and `NAME`.gpg",
+							},
+							&cli.BoolFlag{
+								Name:  "publish",
+								Usage: "Publish the public keys under keys/ in the repository storage",
+							},
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: "Name of the published keyring",
+								Value: "archive-keyring",
+							},
+							&cli.StringFlag{
+								Name:  "url",
+								Usage: "Also publish sources/<codename>.sources files pointing apt at repositories under `URL`",
+							},
+							&cli.StringFlag{
+								Name:  "signed-by",
+								Usage: "Keyring path for Signed-By in published .sources files (default: /etc/apt/keyrings/<name>.gpg)",
+							},
+						},
+						Action: func(ctx context.Context, command *cli.Command) error {
+							if command.String("output") == "" && !command.Bool("publish") {
+								return cli.ShowSubcommandHelp(command)
+							}
+
+							mgr, err := newManager(ctx, config.NeedStorage)
 							if err != nil {
 								return err
 							}
-							return mgr.DeleteRepo(command.Args().First())
+
+							if output := command.String("output"); output != "" {
+								armored, keyring, err := mgr.ExportKeys()
+								if err != nil {
+									return err
+								}
+								if err := os.WriteFile(output+".asc", armored, 0644); err != nil {
+									return err
+								}
+								if err := os.WriteFile(output+".gpg", keyring, 0644); err != nil {
+									return err
+								}
+							}
+
+							if command.Bool("publish") {
+								return mgr.PublishKeys(command.String("name"), command.String("url"), command.String("signed-by"))
+							}
+							return nil
 						},
 					},
 				},
@@ -291,3 +739,165 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+func newManager(ctx context.Context, req config.Requirement) (*manager.Manager, error) {
+	cfg := ctx.Value("config").(*config.Config)
+	if err := cfg.Validate(req, manager.ConfigChecks()); err != nil {
+		return nil, err
+	}
+
+	mgr, err := manager.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mgr.SetEventHandler(printEvent)
+	return mgr, nil
+}
+
+func printEvent(e manager.Event) {
+	switch e.Kind {
+	case manager.EventWarning:
+		fmt.Fprintf(os.Stderr, "Warning: repository %s: %v\n", e.Suite, e.Err)
+	case manager.EventPackageUploaded:
+		fmt.Printf("Upload package %s\n", e.Path)
+	case manager.EventPackageRemoved:
+		fmt.Printf("Remove package %s\n", path.Base(e.Path))
+	case manager.EventRepoResigned:
+		fmt.Printf("Re-signed repository %s\n", e.Suite)
+	case manager.EventFilePublished:
+		fmt.Printf("Published %s\n", e.Path)
+	}
+}
+
+func releaseFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name: "version",
+		},
+		&cli.StringFlag{
+			Name:  "changelogs",
+			Usage: "Changelogs URL template, e.g. https://example.com/changelogs/@CHANGEPATH@_changelog",
+		},
+		&cli.StringFlag{
+			Name:  "signed-by",
+			Usage: "Comma separated fingerprints of keys allowed to sign the repository",
+		},
+		&cli.DurationFlag{
+			Name:  "valid-for",
+			Usage: "Set Valid-Until to `DURATION` after every signature, 0 to disable",
+		},
+		&cli.BoolFlag{
+			Name: "not-automatic",
+		},
+		&cli.BoolFlag{
+			Name: "but-automatic-upgrades",
+		},
+		&cli.BoolFlag{
+			Name:  "acquire-by-hash",
+			Usage: "Publish indices under by-hash paths",
+		},
+		&cli.BoolFlag{
+			Name:  "no-support-for-architecture-all",
+			Usage: "Declare that Architecture: all packages are listed in every binary-<arch> index",
+		},
+	}
+}
+
+func releaseOptions(command *cli.Command) manager.ReleaseOptions {
+	var opts manager.ReleaseOptions
+
+	for name, target := range map[string]**string{
+		"origin":      &opts.Origin,
+		"label":       &opts.Label,
+		"description": &opts.Description,
+		"version":     &opts.Version,
+		"changelogs":  &opts.Changelogs,
+		"signed-by":   &opts.SignedBy,
+	} {
+		if command.IsSet(name) {
+			v := command.String(name)
+			*target = &v
+		}
+	}
+
+	for name, target := range map[string]**bool{
+		"not-automatic":                   &opts.NotAutomatic,
+		"but-automatic-upgrades":          &opts.ButAutomaticUpgrades,
+		"acquire-by-hash":                 &opts.AcquireByHash,
+		"no-support-for-architecture-all": &opts.NoSupportForArchitectureAll,
+	} {
+		if command.IsSet(name) {
+			v := command.Bool(name)
+			*target = &v
+		}
+	}
+
+	if command.IsSet("valid-for") {
+		v := command.Duration("valid-for")
+		opts.ValidFor = &v
+	}
+
+	return opts
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+func printRepos(releases []*manager.Release) {
+	if len(releases) == 0 {
+		fmt.Printf("No repositories found, create one with `faptly repo create ...`.\n")
+		return
+	}
+
+	sb := new(strings.Builder)
+	for _, release := range releases {
+		name := release.Dir()
+		if release.Suite != "" && release.Suite != name {
+			name += " (" + release.Suite + ")"
+		}
+		sb.WriteString(fmt.Sprintf(
+			" * %s [%s] (%s): %s\n",
+			name,
+			strings.Join(release.Components, ", "),
+			strings.Join(release.Architectures, "|"),
+			release.Description),
+		)
+	}
+	fmt.Printf("List of repositories:\n%s\nTo get more information about local repository, run `faptly repo show <codename>`.\n", sb.String())
+}
+
+func printRepo(release *manager.Release) error {
+	if err := control.Marshal(os.Stdout, release); err != nil {
+		return err
+	}
+
+	for _, sig := range release.Signatures() {
+		fmt.Printf("\nSigned by %s on %s\n", sig.Fingerprint, sig.Date.UTC().Format(time.RFC1123))
+	}
+	return nil
+}
+
+func printPkgs(indexes []control.BinaryIndex) {
+	if len(indexes) == 0 {
+		fmt.Printf("No packages found, upload one with `faptly pkg upload ...`.\n")
+		return
+	}
+
+	sb := new(strings.Builder)
+	for _, index := range indexes {
+		sb.WriteString(fmt.Sprintf(" - %s\n", filepath.Base(index.Filename)))
+	}
+	fmt.Printf("List of packages:\n%s\nTo get more information about package, run `faptly pkg show <package>`.\n", sb.String())
+}
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/akozlenkov/faptly/config"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RepoPlan holds the changes bringing one repository in line with its
+// declaration in the config.
+type RepoPlan struct {
+	Codename string
+	Create   bool
+	Changes  []string
+
+	// Destructive is set when components or architectures are removed
+	// together with their packages.
+	Destructive bool
+
+	repo    config.RepoConfig
+	options ReleaseOptions
+	edit    RepoChanges
+	suite   string
+}
+
+// Empty reports whether the repository already matches its declaration.
+func (p RepoPlan) Empty() bool {
+	return !p.Create && len(p.Changes) == 0
+}
+
+// PlanRepos compares the declared repositories with the ones in storage,
+// returning a plan for each of them sorted by codename.
+func (m *Manager) PlanRepos(repos map[string]config.RepoConfig) ([]RepoPlan, error) {
+	codenames := make([]string, 0, len(repos))
+	for codename := range repos {
+		codenames = append(codenames, codename)
+	}
+	sort.Strings(codenames)
+
+	plans := make([]RepoPlan, 0, len(repos))
+	for _, codename := range codenames {
+		plan, err := m.planRepo(codename, repos[codename])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", codename, err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, nil
+}
+
+func (m *Manager) planRepo(codename string, repo config.RepoConfig) (RepoPlan, error) {
+	plan := RepoPlan{Codename: codename, repo: repo}
+
+	for _, name := range []string{codename, repo.Suite} {
+		if name != "" && !validName.MatchString(name) {
+			return plan, fmt.Errorf("invalid repository name %q", name)
+		}
+	}
+	if err := checkComponents(repo.Components); err != nil {
+		return plan, err
+	}
+
+	architectures, err := canonicalArchitectures(repo.Architectures)
+	if err != nil {
+		return plan, err
+	}
+	plan.repo.Architectures = architectures
+
+	options, err := declaredOptions(repo)
+	if err != nil {
+		return plan, err
+	}
+
+	if !m.repoExists(codename) {
+		plan.Create = true
+		plan.options = options
+		if plan.repo.Suite == "" {
+			plan.repo.Suite = codename
+		}
+		if plan.repo.Suite != codename {
+			if err := m.checkAlias(plan.repo.Suite, codename); err != nil {
+				return plan, err
+			}
+		}
+
+		plan.Changes = append(plan.Changes,
+			fmt.Sprintf("suite: %s", plan.repo.Suite),
+			fmt.Sprintf("components: %s", strings.Join(repo.Components, ", ")),
+			fmt.Sprintf("architectures: %s", strings.Join(architectures, ", ")),
+		)
+		return plan, nil
+	}
+
+	if target := m.aliasOf(codename); target != "" {
+		return plan, fmt.Errorf("%s is a suite alias of %s, declare repositories by codename", codename, target)
+	}
+
+	release, err := m.getRelease(codename)
+	if err != nil {
+		return plan, err
+	}
+
+	current := &Release{
+		Origin:                      release.Origin,
+		Label:                       release.Label,
+		Description:                 release.Description,
+		Version:                     release.Version,
+		Changelogs:                  release.Changelogs,
+		SignedBy:                    release.SignedBy,
+		NotAutomatic:                release.NotAutomatic,
+		ButAutomaticUpgrades:        release.ButAutomaticUpgrades,
+		AcquireByHash:               release.AcquireByHash,
+		NoSupportForArchitectureAll: release.NoSupportForArchitectureAll,
+	}
+	desired := *current
+	options.Apply(&desired)
+
+	for _, field := range []struct {
+		name           string
+		current, value string
+		target         **string
+	}{
+		{"origin", current.Origin, desired.Origin, &plan.options.Origin},
+		{"label", current.Label, desired.Label, &plan.options.Label},
+		{"description", current.Description, desired.Description, &plan.options.Description},
+		{"version", current.Version, desired.Version, &plan.options.Version},
+		{"changelogs", current.Changelogs, desired.Changelogs, &plan.options.Changelogs},
+		{"signed_by", current.SignedBy, desired.SignedBy, &plan.options.SignedBy},
+		{"not_automatic", current.NotAutomatic, desired.NotAutomatic, nil},
+		{"but_automatic_upgrades", current.ButAutomaticUpgrades, desired.ButAutomaticUpgrades, nil},
+		{"acquire_by_hash", current.AcquireByHash, desired.AcquireByHash, nil},
+		{"no_support_for_architecture_all", current.NoSupportForArchitectureAll, desired.NoSupportForArchitectureAll, nil},
+	} {
+		if field.current == field.value {
+			continue
+		}
+		if field.target == nil {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %t -> %t", field.name, field.current != "", field.value != ""))
+			continue
+		}
+		plan.Changes = append(plan.Changes, fmt.Sprintf("%s: %q -> %q", field.name, field.current, field.value))
+		value := field.value
+		*field.target = &value
+	}
+	plan.options.NotAutomatic = changedBool(current.NotAutomatic, desired.NotAutomatic)
+	plan.options.ButAutomaticUpgrades = changedBool(current.ButAutomaticUpgrades, desired.ButAutomaticUpgrades)
+	plan.options.AcquireByHash = changedBool(current.AcquireByHash, desired.AcquireByHash)
+	plan.options.NoSupportForArchitectureAll = changedBool(current.NoSupportForArchitectureAll, desired.NoSupportForArchitectureAll)
+
+	if options.ValidFor != nil && release.ValidFor().Round(time.Second) != options.ValidFor.Round(time.Second) {
+		plan.Changes = append(plan.Changes, fmt.Sprintf("valid_for: %s -> %s", release.ValidFor().Round(time.Second), *options.ValidFor))
+		plan.options.ValidFor = options.ValidFor
+	}
+
+	plan.edit.AddComponents, plan.edit.RemoveComponents = diffLists(release.Components, repo.Components)
+	plan.edit.AddArchitectures, plan.edit.RemoveArchitectures = diffLists(release.Architectures, architectures)
+
+	for _, list := range []struct {
+		kind   string
+		add    []string
+		remove []string
+	}{
+		{"component", plan.edit.AddComponents, plan.edit.RemoveComponents},
+		{"architecture", plan.edit.AddArchitectures, plan.edit.RemoveArchitectures},
+	} {
+		for _, v := range list.add {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("+ %s %s", list.kind, v))
+		}
+		for _, v := range list.remove {
+			plan.Changes = append(plan.Changes, fmt.Sprintf("- %s %s, removing its packages", list.kind, v))
+			plan.Destructive = true
+		}
+	}
+
+	if repo.Suite != "" && repo.Suite != release.Suite {
+		if repo.Suite != codename {
+			if err := m.checkAlias(repo.Suite, codename); err != nil {
+				return plan, err
+			}
+		}
+		plan.suite = repo.Suite
+		plan.Changes = append(plan.Changes, fmt.Sprintf("suite: %s -> %s", release.Suite, repo.Suite))
+	}
+
+	return plan, nil
+}
+
+// ApplyRepos carries out plans made by PlanRepos.
+func (m *Manager) ApplyRepos(plans []RepoPlan) error {
+	for _, plan := range plans {
+		if err := m.applyRepo(plan); err != nil {
+			return fmt.Errorf("%s: %w", plan.Codename, err)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) applyRepo(plan RepoPlan) error {
+	if plan.Create {
+		return m.CreateRepo(
+			plan.repo.Origin,
+			plan.repo.Suite,
+			plan.repo.Label,
+			plan.Codename,
+			plan.repo.Description,
+			plan.repo.Components,
+			plan.repo.Architectures,
+			plan.options,
+		)
+	}
+
+	if plan.options != (ReleaseOptions{}) ||
+		len(plan.edit.AddComponents)+len(plan.edit.RemoveComponents)+len(plan.edit.AddArchitectures)+len(plan.edit.RemoveArchitectures) != 0 {
+		if err := m.EditRepo(plan.Codename, plan.options, plan.edit); err != nil {
+			return err
+		}
+	}
+
+	if plan.suite != "" {
+		return m.PointSuite(plan.suite, plan.Codename, "")
+	}
+	return nil
+}
+
+func declaredOptions(repo config.RepoConfig) (ReleaseOptions, error) {
+	opts := ReleaseOptions{
+		Version:                     repo.Version,
+		Changelogs:                  repo.Changelogs,
+		SignedBy:                    repo.SignedBy,
+		NotAutomatic:                repo.NotAutomatic,
+		ButAutomaticUpgrades:        repo.ButAutomaticUpgrades,
+		AcquireByHash:               repo.AcquireByHash,
+		NoSupportForArchitectureAll: repo.NoSupportForArchitectureAll,
+	}
+
+	for _, field := range []struct {
+		value  string
+		target **string
+	}{
+		{repo.Origin, &opts.Origin},
+		{repo.Label, &opts.Label},
+		{repo.Description, &opts.Description},
+	} {
+		if field.value != "" {
+			value := field.value
+			*field.target = &value
+		}
+	}
+
+	if repo.ValidFor != nil {
+		var d time.Duration
+		if *repo.ValidFor != "" {
+			var err error
+			if d, err = time.ParseDuration(*repo.ValidFor); err != nil {
+				return opts, fmt.Errorf("invalid valid_for: %w", err)
+			}
+		}
+		opts.ValidFor = &d
+	}
+	return opts, nil
+}
+
+func changedBool(current, desired string) *bool {
+	if current == desired {
+		return nil
+	}
+	v := desired != ""
+	return &v
+}
+
+func diffLists(current, desired []string) (add, remove []string) {
+	for _, v := range desired {
+		if !slices.Contains(current, v) {
+			add = append(add, v)
+		}
+	}
+	for _, v := range current {
+		if !slices.Contains(desired, v) {
+			remove = append(remove, v)
+		}
+	}
+	return add, remove
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"github.com/akozlenkov/faptly/config"
+	"slices"
+	"testing"
+)
+
+func TestDiffLists(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		current, desired []string
+		add, remove      []string
+	}{
+		{name: "equal", current: []string{"main", "contrib"}, desired: []string{"contrib", "main"}},
+		{name: "add", current: []string{"main"}, desired: []string{"main", "contrib"}, add: []string{"contrib"}},
+		{name: "remove", current: []string{"main", "contrib"}, desired: []string{"main"}, remove: []string{"contrib"}},
+		{name: "replace", current: []string{"amd64"}, desired: []string{"arm64"}, add: []string{"arm64"}, remove: []string{"amd64"}},
+		{name: "from nothing", desired: []string{"main"}, add: []string{"main"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			add, remove := diffLists(tt.current, tt.desired)
+			if !slices.Equal(add, tt.add) || !slices.Equal(remove, tt.remove) {
+				t.Errorf("diffLists(%v, %v) = %v, %v, want %v, %v", tt.current, tt.desired, add, remove, tt.add, tt.remove)
+			}
+		})
+	}
+}
+
+func TestPlanRepo(t *testing.T) {
+	c, _ := testRepo(t, "trixie")
+	m := newTestManager(t, c)
+
+	version := "13"
+	if err := m.EditRepo("trixie", ReleaseOptions{Version: &version}, RepoChanges{}); err != nil {
+		t.Fatal(err)
+	}
+
+	empty, validFor := "", "24h"
+
+	for _, tt := range []struct {
+		name        string
+		codename    string
+		repo        config.RepoConfig
+		create      bool
+		changes     []string
+		destructive bool
+		err         bool
+	}{
+		{
+			name:     "up to date",
+			codename: "trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}},
+		},
+		{
+			name:     "create",
+			codename: "forky",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}},
+			create:   true,
+			changes:  []string{"suite: forky", "components: main", "architectures: amd64"},
+		},
+		{
+			name:     "clear version",
+			codename: "trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}, Version: &empty},
+			changes:  []string{`version: "13" -> ""`},
+		},
+		{
+			name:     "set valid_for",
+			codename: "trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}, ValidFor: &validFor},
+			changes:  []string{"valid_for: 0s -> 24h0m0s"},
+		},
+		{
+			name:     "clear unset valid_for",
+			codename: "trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}, ValidFor: &empty},
+		},
+		{
+			name:        "replace components and architectures",
+			codename:    "trixie",
+			repo:        config.RepoConfig{Components: []string{"contrib"}, Architectures: []string{"arm64", "amd64"}},
+			changes:     []string{"+ component contrib", "- component main, removing its packages", "+ architecture arm64"},
+			destructive: true,
+		},
+		{
+			name:     "wildcard architecture",
+			codename: "trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"any"}},
+			err:      true,
+		},
+		{
+			name:     "invalid name",
+			codename: "../trixie",
+			repo:     config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}},
+			err:      true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := m.planRepo(tt.codename, tt.repo)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("planRepo(%q) = %+v, want error", tt.codename, plan)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("planRepo(%q): %v", tt.codename, err)
+			}
+			if plan.Create != tt.create {
+				t.Errorf("Create = %t, want %t", plan.Create, tt.create)
+			}
+			if !slices.Equal(plan.Changes, tt.changes) {
+				t.Errorf("Changes = %q, want %q", plan.Changes, tt.changes)
+			}
+			if plan.Destructive != tt.destructive {
+				t.Errorf("Destructive = %t, want %t", plan.Destructive, tt.destructive)
+			}
+			if plan.Empty() != (len(tt.changes) == 0 && !tt.create) {
+				t.Errorf("Empty() = %t with changes %q", plan.Empty(), plan.Changes)
+			}
+		})
+	}
+}
+
+func TestApplyReposClearsOptions(t *testing.T) {
+	c, _ := testRepo(t, "trixie")
+	m := newTestManager(t, c)
+
+	version, validFor := "13", "24h"
+	repos := map[string]config.RepoConfig{
+		"trixie": {Components: []string{"main"}, Architectures: []string{"amd64"}, Version: &version, ValidFor: &validFor},
+	}
+	apply := func() {
+		t.Helper()
+		plans, err := m.PlanRepos(repos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.ApplyRepos(plans); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	apply()
+	release, err := m.getRelease("trixie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "13" || release.ValidUntil.IsZero() {
+		t.Fatalf("Version = %q, Valid-Until = %v, want 13 and a date", release.Version, release.ValidUntil)
+	}
+
+	empty := ""
+	repos["trixie"] = config.RepoConfig{Components: []string{"main"}, Architectures: []string{"amd64"}, Version: &empty, ValidFor: &empty}
+	apply()
+	release, err = m.getRelease("trixie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if release.Version != "" || !release.ValidUntil.IsZero() {
+		t.Errorf("Version = %q, Valid-Until = %v, want both cleared", release.Version, release.ValidUntil)
+	}
+}
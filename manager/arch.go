@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"io"
+	"strings"
+)
+
+type Architecture struct {
+	Name string
+	ABI  string
+	Libc string
+	OS   string
+	CPU  string
+}
+
+var cpuTable = []string{
+	"alpha", "amd64", "arc", "arm", "arm64", "armeb", "avr32", "hppa", "i386", "ia64",
+	"loong64", "m32r", "m68k", "mips", "mips64", "mips64el", "mips64r6", "mips64r6el",
+	"mipsel", "mipsr6", "mipsr6el", "nios2", "or1k", "powerpc", "powerpcel", "ppc64",
+	"ppc64el", "riscv64", "s390", "s390x", "sh3", "sh3eb", "sh4", "sh4eb", "sparc", "sparc64",
+}
+
+var tupleTable = [][2]string{
+	{"eabihf-musl-linux-arm", "musl-linux-armhf"},
+	{"base-musl-linux-<cpu>", "musl-linux-<cpu>"},
+	{"ilp32-gnu-linux-arm64", "arm64ilp32"},
+	{"eabihf-gnu-linux-arm", "armhf"},
+	{"eabi-gnu-linux-arm", "armel"},
+	{"abin32-gnu-linux-mips64r6el", "mipsn32r6el"},
+	{"abin32-gnu-linux-mips64r6", "mipsn32r6"},
+	{"abin32-gnu-linux-mips64el", "mipsn32el"},
+	{"abin32-gnu-linux-mips64", "mipsn32"},
+	{"abi64-gnu-linux-mips64r6el", "mips64r6el"},
+	{"abi64-gnu-linux-mips64r6", "mips64r6"},
+	{"abi64-gnu-linux-mips64el", "mips64el"},
+	{"abi64-gnu-linux-mips64", "mips64"},
+	{"spe-gnu-linux-powerpc", "powerpcspe"},
+	{"x32-gnu-linux-amd64", "x32"},
+	{"base-gnu-linux-<cpu>", "<cpu>"},
+	{"eabihf-gnu-kfreebsd-arm", "kfreebsd-armhf"},
+	{"base-gnu-kfreebsd-<cpu>", "kfreebsd-<cpu>"},
+	{"base-gnu-knetbsd-<cpu>", "knetbsd-<cpu>"},
+	{"base-gnu-kopensolaris-<cpu>", "kopensolaris-<cpu>"},
+	{"base-gnu-hurd-<cpu>", "hurd-<cpu>"},
+	{"base-bsd-dragonflybsd-<cpu>", "dragonflybsd-<cpu>"},
+	{"base-bsd-freebsd-<cpu>", "freebsd-<cpu>"},
+	{"base-bsd-openbsd-<cpu>", "openbsd-<cpu>"},
+	{"base-bsd-netbsd-<cpu>", "netbsd-<cpu>"},
+	{"base-bsd-darwin-<cpu>", "darwin-<cpu>"},
+	{"base-sysv-aix-<cpu>", "aix-<cpu>"},
+	{"base-sysv-solaris-<cpu>", "solaris-<cpu>"},
+	{"eabi-uclibc-linux-arm", "uclibc-linux-armel"},
+	{"base-uclibc-linux-<cpu>", "uclibc-linux-<cpu>"},
+	{"base-tos-mint-m68k", "mint-m68k"},
+}
+
+var architectures = func() map[string]Architecture {
+	ret := make(map[string]Architecture)
+	add := func(tuple, name string) {
+		if _, ok := ret[name]; ok {
+			return
+		}
+		t := strings.SplitN(tuple, "-", 4)
+		ret[name] = Architecture{Name: name, ABI: t[0], Libc: t[1], OS: t[2], CPU: t[3]}
+	}
+
+	for _, entry := range tupleTable {
+		if !strings.Contains(entry[0], "<cpu>") {
+			add(entry[0], entry[1])
+			continue
+		}
+		for _, cpu := range cpuTable {
+			add(strings.ReplaceAll(entry[0], "<cpu>", cpu), strings.ReplaceAll(entry[1], "<cpu>", cpu))
+		}
+	}
+	return ret
+}()
+
+func ParseArchitecture(name string) (Architecture, error) {
+	switch name {
+	case "all":
+		return Architecture{Name: name, ABI: name, Libc: name, OS: name, CPU: name}, nil
+	case "any":
+		return Architecture{Name: name, ABI: name, Libc: name, OS: name, CPU: name}, nil
+	}
+
+	parts := strings.Split(name, "-")
+	for _, part := range parts {
+		if part != "any" {
+			continue
+		}
+		if len(parts) > 4 {
+			break
+		}
+		t := append(make([]string, 4-len(parts)), parts...)
+		for i := range t {
+			if t[i] == "" {
+				t[i] = "any"
+			}
+		}
+		return Architecture{Name: name, ABI: t[0], Libc: t[1], OS: t[2], CPU: t[3]}, nil
+	}
+
+	if arch, ok := architectures[name]; ok {
+		return arch, nil
+	}
+	return Architecture{}, fmt.Errorf("unknown architecture %s", name)
+}
+
+func (a Architecture) IsWildcard() bool {
+	return a.Name != "all" && (a.ABI == "any" || a.Libc == "any" || a.OS == "any" || a.CPU == "any")
+}
+
+func (a Architecture) Matches(pattern Architecture) bool {
+	if a.Name == "all" || pattern.Name == "all" {
+		return a.Name == pattern.Name
+	}
+
+	for _, field := range [][2]string{
+		{a.ABI, pattern.ABI},
+		{a.Libc, pattern.Libc},
+		{a.OS, pattern.OS},
+		{a.CPU, pattern.CPU},
+	} {
+		if field[1] != "any" && field[0] != field[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func matchArchitectures(names []string, pattern string) ([]string, error) {
+	p, err := ParseArchitecture(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, name := range names {
+		arch, err := ParseArchitecture(name)
+		if err != nil {
+			return nil, err
+		}
+		if arch.Matches(p) {
+			ret = append(ret, name)
+		}
+	}
+	return ret, nil
+}
+
+func canonicalArchitectures(names []string) ([]string, error) {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		arch, err := ParseArchitecture(name)
+		if err != nil {
+			return nil, err
+		}
+		if arch.IsWildcard() || arch.Name == "all" {
+			return nil, fmt.Errorf("architecture %s can't be used as a repository architecture", name)
+		}
+		ret[i] = arch.Name
+	}
+	return ret, nil
+}
+
+// packageArch returns the Debian architecture name of a package. go-debian
+// parses Architecture into its own tuple, which can't represent names such
+// as armhf or musl-linux-amd64, so the raw field is the one to go by.
+func packageArch(idx *control.BinaryIndex) string {
+	return strings.TrimSpace(idx.Values["Architecture"])
+}
+
+func normalizeArch(idx *control.BinaryIndex) error {
+	arch, err := ParseArchitecture(packageArch(idx))
+	if err != nil {
+		return err
+	}
+	if arch.IsWildcard() {
+		return fmt.Errorf("wildcard architecture %s is not allowed for binary packages", arch.Name)
+	}
+	idx.Values["Architecture"] = arch.Name
+	return nil
+}
+
+// MarshalPackages writes indexes as Packages file paragraphs, keeping the
+// Architecture field as it was read rather than as go-debian renders it.
+func MarshalPackages(w io.Writer, indexes ...control.BinaryIndex) error {
+	for i := range indexes {
+		paragraph, err := control.ConvertToParagraph(&indexes[i])
+		if err != nil {
+			return err
+		}
+		if arch := packageArch(&indexes[i]); arch != "" {
+			paragraph.Set("Architecture", arch)
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		if err := paragraph.WriteTo(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
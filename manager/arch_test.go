@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/akozlenkov/go-debian/control"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseArchitecture(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		want     Architecture
+		wildcard bool
+		err      bool
+	}{
+		{name: "amd64", want: Architecture{Name: "amd64", ABI: "base", Libc: "gnu", OS: "linux", CPU: "amd64"}},
+		{name: "armhf", want: Architecture{Name: "armhf", ABI: "eabihf", Libc: "gnu", OS: "linux", CPU: "arm"}},
+		{name: "arm64ilp32", want: Architecture{Name: "arm64ilp32", ABI: "ilp32", Libc: "gnu", OS: "linux", CPU: "arm64"}},
+		{name: "musl-linux-amd64", want: Architecture{Name: "musl-linux-amd64", ABI: "base", Libc: "musl", OS: "linux", CPU: "amd64"}},
+		{name: "musl-linux-armhf", want: Architecture{Name: "musl-linux-armhf", ABI: "eabihf", Libc: "musl", OS: "linux", CPU: "arm"}},
+		{name: "kfreebsd-amd64", want: Architecture{Name: "kfreebsd-amd64", ABI: "base", Libc: "gnu", OS: "kfreebsd", CPU: "amd64"}},
+		{name: "all", want: Architecture{Name: "all", ABI: "all", Libc: "all", OS: "all", CPU: "all"}},
+		{name: "any", want: Architecture{Name: "any", ABI: "any", Libc: "any", OS: "any", CPU: "any"}, wildcard: true},
+		{name: "linux-any", want: Architecture{Name: "linux-any", ABI: "any", Libc: "any", OS: "linux", CPU: "any"}, wildcard: true},
+		{name: "any-arm64", want: Architecture{Name: "any-arm64", ABI: "any", Libc: "any", OS: "any", CPU: "arm64"}, wildcard: true},
+		{name: "musl-any-any", want: Architecture{Name: "musl-any-any", ABI: "any", Libc: "musl", OS: "any", CPU: "any"}, wildcard: true},
+		{name: "amd65", err: true},
+		{name: "", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseArchitecture(tt.name)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("ParseArchitecture(%q) = %+v, want error", tt.name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseArchitecture(%q): %v", tt.name, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseArchitecture(%q) = %+v, want %+v", tt.name, got, tt.want)
+			}
+			if got.IsWildcard() != tt.wildcard {
+				t.Errorf("ParseArchitecture(%q).IsWildcard() = %t, want %t", tt.name, got.IsWildcard(), tt.wildcard)
+			}
+		})
+	}
+}
+
+func TestMatchArchitectures(t *testing.T) {
+	names := []string{"amd64", "arm64", "armhf", "i386", "musl-linux-amd64", "kfreebsd-amd64"}
+
+	for _, tt := range []struct {
+		pattern string
+		want    []string
+		err     bool
+	}{
+		{pattern: "amd64", want: []string{"amd64"}},
+		{pattern: "any", want: names},
+		{pattern: "any-amd64", want: []string{"amd64", "musl-linux-amd64", "kfreebsd-amd64"}},
+		{pattern: "linux-any", want: []string{"amd64", "arm64", "armhf", "i386", "musl-linux-amd64"}},
+		{pattern: "musl-any-any", want: []string{"musl-linux-amd64"}},
+		{pattern: "any-arm", want: []string{"armhf"}},
+		{pattern: "all"},
+		{pattern: "s390x"},
+		{pattern: "bogus", err: true},
+	} {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got, err := matchArchitectures(names, tt.pattern)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("matchArchitectures(%q) = %v, want error", tt.pattern, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("matchArchitectures(%q): %v", tt.pattern, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("matchArchitectures(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalPackagesKeepsArchitecture(t *testing.T) {
+	const paragraphs = `Package: hello
+Version: 1.0
+Architecture: armhf
+Filename: pool/main/h/hello/hello_1.0_armhf.deb
+
+Package: hello-musl
+Version: 1.0
+Architecture: musl-linux-amd64
+Filename: pool/main/h/hello-musl/hello-musl_1.0_musl-linux-amd64.deb
+`
+	indexes, err := control.ParseBinaryIndex(bufio.NewReader(strings.NewReader(paragraphs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := MarshalPackages(&buf, indexes...); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"Architecture: armhf\n", "Architecture: musl-linux-amd64\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("MarshalPackages output is missing %q:\n%s", want, buf.String())
+		}
+	}
+	if n := strings.Count(buf.String(), "\n\n"); n != 1 {
+		t.Errorf("MarshalPackages output has %d paragraph separators, want 1:\n%s", n, buf.String())
+	}
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"gopkg.in/yaml.v3"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// byHashGenerations is how many releases keep their by-hash objects, so that
+// clients holding a slightly older InRelease can still fetch what it lists.
+const byHashGenerations = 3
+
+const byHashFile = "by-hash.yaml"
+
+// byHashHistory records the by-hash objects of the last releases, relative to
+// the repository directory, oldest first.
+type byHashHistory struct {
+	Generations [][]string `yaml:"generations"`
+}
+
+func byHashPath(fh control.SHA256FileHash) string {
+	return path.Join(path.Dir(fh.Filename), "by-hash", "SHA256", fh.Hash)
+}
+
+func isByHash(p string) bool {
+	return strings.Contains("/"+p, "/by-hash/")
+}
+
+// publishByHash copies the indices listed in release to their by-hash names
+// and removes the by-hash objects that none of the last byHashGenerations
+// releases lists, all of them once Acquire-By-Hash is turned off. The removed
+// objects are recorded in release.prunedByHash.
+func (m *Manager) publishByHash(release *Release) error {
+	dir := path.Join(DistsDir, release.Dir()) + "/"
+
+	var current []string
+	if release.AcquireByHash == "yes" {
+		for _, fh := range release.SHA256 {
+			p := byHashPath(fh)
+			if err := m.copyFile(dir+fh.Filename, dir+p); err != nil {
+				return err
+			}
+			current = append(current, p)
+		}
+		sort.Strings(current)
+	}
+
+	var stored []string
+	if err := m.storage.Walk(dir, func(found string, err error) error {
+		if err != nil {
+			return err
+		}
+		if p := strings.TrimPrefix(found, dir); isByHash(p) {
+			stored = append(stored, p)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	history, err := m.readByHashHistory(release.Dir())
+	if err != nil {
+		return err
+	}
+
+	switch n := len(history.Generations); {
+	case current == nil:
+		history.Generations = nil
+	case n == 0 || !slices.Equal(history.Generations[n-1], current):
+		history.Generations = append(history.Generations, current)
+	}
+	if n := len(history.Generations); n > byHashGenerations {
+		history.Generations = history.Generations[n-byHashGenerations:]
+	}
+
+	keep := make(map[string]bool)
+	for _, generation := range history.Generations {
+		for _, p := range generation {
+			keep[p] = true
+		}
+	}
+	release.prunedByHash = nil
+	for _, p := range stored {
+		if keep[p] {
+			continue
+		}
+		if err := m.storage.Remove(dir + p); err != nil {
+			return err
+		}
+		release.prunedByHash = append(release.prunedByHash, p)
+	}
+
+	return m.writeByHashHistory(release.Dir(), history)
+}
+
+func (m *Manager) readByHashHistory(dir string) (*byHashHistory, error) {
+	history := new(byHashHistory)
+
+	p := metadataPath(dir, byHashFile)
+	if !m.storage.Exists(p) {
+		return history, nil
+	}
+
+	data, err := m.storage.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, history); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	return history, nil
+}
+
+func (m *Manager) writeByHashHistory(dir string, history *byHashHistory) error {
+	p := metadataPath(dir, byHashFile)
+	if len(history.Generations) == 0 {
+		if m.storage.Exists(p) {
+			return m.storage.Remove(p)
+		}
+		return nil
+	}
+
+	data, err := yaml.Marshal(history)
+	if err != nil {
+		return err
+	}
+	return m.writeFile(p, data, nil)
+}
@@ -0,0 +1,61 @@
+package manager
+
+import (
+	"fmt"
+	"path"
+	"testing"
+)
+
+func TestPublishByHash(t *testing.T) {
+	c, _ := testRepo(t, "trixie")
+	m := newTestManager(t, c)
+	dir := t.TempDir()
+
+	setByHash := func(on bool) {
+		t.Helper()
+		if err := m.EditRepo("trixie", ReleaseOptions{AcquireByHash: &on}, RepoChanges{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	packagesByHash := func() string {
+		t.Helper()
+		release, err := m.getRelease("trixie")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, fh := range release.SHA256 {
+			if fh.Filename == "main/binary-amd64/Packages" {
+				return path.Join(DistsDir, "trixie", byHashPath(fh))
+			}
+		}
+		t.Fatal("Release doesn't list main/binary-amd64/Packages")
+		return ""
+	}
+
+	setByHash(true)
+	generations := []string{packagesByHash()}
+	for i := 1; i <= byHashGenerations; i++ {
+		control := fmt.Sprintf("Package: hello\nVersion: 1.%d\nArchitecture: amd64\n", i)
+		if err := m.UploadPkgs("trixie", "main", []string{writeDeb(t, dir, fmt.Sprintf("hello_1.%d_amd64.deb", i), control)}); err != nil {
+			t.Fatal(err)
+		}
+		generations = append(generations, packagesByHash())
+	}
+
+	// The Packages of the edit is one release too old to be kept.
+	if m.storage.Exists(generations[0]) {
+		t.Errorf("%s wasn't pruned", generations[0])
+	}
+	for _, p := range generations[1:] {
+		if !m.storage.Exists(p) {
+			t.Errorf("%s was pruned", p)
+		}
+	}
+
+	setByHash(false)
+	for _, p := range append(generations, metadataPath("trixie", byHashFile)) {
+		if m.storage.Exists(p) {
+			t.Errorf("%s exists with Acquire-By-Hash off", p)
+		}
+	}
+}
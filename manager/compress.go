@@ -0,0 +1,38 @@
+package manager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/ulikunitz/xz"
+	"io"
+)
+
+func compress(ext string, data []byte) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		stream io.WriteCloser
+		err    error
+	)
+
+	switch ext {
+	case "":
+		return data, nil
+	case ".gz":
+		stream = gzip.NewWriter(&buf)
+	case ".xz":
+		if stream, err = xz.NewWriter(&buf); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("compression type %s not supported", ext)
+	}
+
+	if _, err := stream.Write(data); err != nil {
+		return nil, err
+	}
+	if err := stream.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
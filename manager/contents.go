@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"path"
+	"slices"
+	"strings"
+)
+
+type contents map[string][]string
+
+func parseContents(data []byte) (contents, error) {
+	c := make(contents)
+	if len(data) == 0 {
+		return c, nil
+	}
+
+	stream, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t")
+		i := strings.LastIndexAny(line, " \t")
+		if i < 0 {
+			continue
+		}
+
+		file := strings.TrimRight(line[:i], " \t")
+		c[file] = append(c[file], strings.Split(line[i+1:], ",")...)
+	}
+	return c, scanner.Err()
+}
+
+func contentsLocation(section, pkg string) string {
+	if section == "" {
+		return pkg
+	}
+	return section + "/" + pkg
+}
+
+func (c contents) remove(pkg string) {
+	c.removePackages(map[string]bool{pkg: true})
+}
+
+func (c contents) removePackages(pkgs map[string]bool) {
+	for file, locations := range c {
+		locations = slices.DeleteFunc(locations, func(location string) bool {
+			return pkgs[path.Base(location)]
+		})
+		if len(locations) == 0 {
+			delete(c, file)
+		} else {
+			c[file] = locations
+		}
+	}
+}
+
+func (c contents) packages() map[string]bool {
+	pkgs := make(map[string]bool)
+	for _, locations := range c {
+		for _, location := range locations {
+			pkgs[path.Base(location)] = true
+		}
+	}
+	return pkgs
+}
+
+// withArchAll makes the Contents-<arch> indices in c list the Architecture:
+// all packages of Contents-all only when the release lists them there too
+// (No-Support-for-Architecture-all), as apt-file would otherwise report their
+// files twice. indexes holds the Packages entries of each architecture so
+// that packages built for the architecture itself are left alone.
+func withArchAll(c map[string]contents, indexes map[string][]control.BinaryIndex, include bool) {
+	all, ok := c["all"]
+	if !ok {
+		return
+	}
+
+	pkgs := all.packages()
+	for arch, files := range c {
+		if arch == "all" {
+			continue
+		}
+
+		own := make(map[string]bool)
+		for _, idx := range indexes[arch] {
+			if packageArch(&idx) != "all" {
+				own[idx.Package] = true
+			}
+		}
+
+		if !include {
+			stale := make(map[string]bool, len(pkgs))
+			for pkg := range pkgs {
+				if !own[pkg] {
+					stale[pkg] = true
+				}
+			}
+			files.removePackages(stale)
+			continue
+		}
+
+		for file, locations := range all {
+			for _, location := range locations {
+				if !own[path.Base(location)] {
+					files.add(location, []string{file})
+				}
+			}
+		}
+	}
+}
+
+func (c contents) add(location string, files []string) {
+	for _, file := range files {
+		if !slices.Contains(c[file], location) {
+			c[file] = append(c[file], location)
+		}
+	}
+}
+
+func (c contents) marshal() ([]byte, error) {
+	files := make([]string, 0, len(c))
+	for file := range c {
+		files = append(files, file)
+	}
+	slices.Sort(files)
+
+	var buf bytes.Buffer
+
+	for _, file := range files {
+		locations := slices.Clone(c[file])
+		slices.Sort(locations)
+		fmt.Fprintf(&buf, "%-59s %s\n", file, strings.Join(locations, ","))
+	}
+	return compress(".gz", buf.Bytes())
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestContentsRoundTrip(t *testing.T) {
+	c := contents{
+		"usr/bin/hello":               {"utils/hello"},
+		"usr/share/doc/a file/README": {"doc/hello-doc", "utils/hello"},
+	}
+
+	data, err := c.marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := parseContents(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(c) {
+		t.Fatalf("parseContents(marshal()) = %v, want %v", parsed, c)
+	}
+	for file, locations := range c {
+		if !slices.Equal(parsed[file], locations) {
+			t.Errorf("%s = %q, want %q", file, parsed[file], locations)
+		}
+	}
+
+	parsed.remove("hello")
+	if len(parsed) != 1 || !slices.Equal(parsed["usr/share/doc/a file/README"], []string{"doc/hello-doc"}) {
+		t.Errorf("remove(hello) left %v, want the README of hello-doc only", parsed)
+	}
+}
+
+func TestUploadContents(t *testing.T) {
+	c, _ := testRepo(t, "trixie")
+	m := newTestManager(t, c)
+	dir := t.TempDir()
+
+	if err := m.UploadPkgs("trixie", "main", []string{
+		writeDeb(t, dir, "hello_1.0_amd64.deb", "Package: hello\nVersion: 1.0\nArchitecture: amd64\nSection: utils\n", "usr/bin/hello"),
+		writeDeb(t, dir, "hello-doc_1.0_all.deb", "Package: hello-doc\nVersion: 1.0\nArchitecture: all\nSection: doc\n", "usr/share/doc/hello-doc/README"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(arch string) contents {
+		t.Helper()
+		c, err := m.getContents(path.Join(DistsDir, "trixie", "main", ContentsFile+"-"+arch+".gz"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Architecture: all packages are only listed in Contents-all.
+	if amd64 := read("amd64"); len(amd64) != 1 || !slices.Equal(amd64["usr/bin/hello"], []string{"utils/hello"}) {
+		t.Errorf("Contents-amd64 = %v, want hello only", amd64)
+	}
+	if all := read("all"); len(all) != 1 || !slices.Equal(all["usr/share/doc/hello-doc/README"], []string{"doc/hello-doc"}) {
+		t.Errorf("Contents-all = %v, want hello-doc only", all)
+	}
+
+	// A new version replaces the files of the previous one.
+	if err := m.UploadPkgs("trixie", "main", []string{
+		writeDeb(t, dir, "hello_1.1_amd64.deb", "Package: hello\nVersion: 1.1\nArchitecture: amd64\nSection: utils\n", "usr/bin/hello-world"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if amd64 := read("amd64"); len(amd64) != 1 || !slices.Equal(amd64["usr/bin/hello-world"], []string{"utils/hello"}) {
+		t.Errorf("Contents-amd64 = %v, want the files of hello 1.1 only", amd64)
+	}
+}
@@ -7,6 +7,9 @@ type Date struct {
 }
 
 func (d Date) MarshalControl() (string, error) {
+	if d.IsZero() {
+		return "", nil
+	}
 	return d.Format(time.RFC1123), nil
 }
 
@@ -0,0 +1,189 @@
+package manager
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"github.com/blakesmith/ar"
+	"github.com/klauspost/compress/zstd"
+	"github.com/xi2/xz"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	arMagic          = "!<arch>\n"
+	debFormatVersion = "2.0"
+)
+
+var requiredControlFields = []string{"Package", "Version", "Architecture"}
+
+type debFile struct {
+	control []byte
+	files   []string
+}
+
+func readDebFile(name string, reader io.Reader) (*debFile, error) {
+	buffered := bufio.NewReader(reader)
+	if magic, err := buffered.Peek(len(arMagic)); err != nil || string(magic) != arMagic {
+		return nil, fmt.Errorf("package %s: not a debian package", name)
+	}
+	archiveReader := ar.NewReader(buffered)
+
+	var (
+		deb      = new(debFile)
+		expected = []string{"debian-binary", "control.tar", "data.tar"}
+	)
+
+	for len(expected) != 0 {
+		header, err := archiveReader.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("package %s: missing %s member", name, expected[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("package %s: %w", name, err)
+		}
+
+		member := strings.Trim(header.Name, "/")
+		if strings.HasPrefix(member, "_") {
+			continue
+		}
+		if !strings.HasPrefix(member, expected[0]) {
+			return nil, fmt.Errorf("package %s: unexpected member %s, expected %s", name, member, expected[0])
+		}
+
+		switch expected[0] {
+		case "debian-binary":
+			data, err := io.ReadAll(archiveReader)
+			if err != nil {
+				return nil, fmt.Errorf("package %s: %s: %w", name, member, err)
+			}
+			if v := strings.TrimSpace(string(data)); v != debFormatVersion {
+				return nil, fmt.Errorf("package %s: unsupported format version %q", name, v)
+			}
+		case "control.tar":
+			if deb.control, err = readControlTar(member, archiveReader); err != nil {
+				return nil, fmt.Errorf("package %s: %s: %w", name, member, err)
+			}
+		case "data.tar":
+			if deb.files, err = readDataTar(member, archiveReader); err != nil {
+				return nil, fmt.Errorf("package %s: %s: %w", name, member, err)
+			}
+		}
+
+		expected = expected[1:]
+	}
+
+	return deb, nil
+}
+
+func readControlTar(member string, reader io.Reader) ([]byte, error) {
+	stream, err := decompress(member, reader)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	controlReader := tar.NewReader(stream)
+	for {
+		header, err := controlReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if path.Clean(header.Name) == "control" {
+			var buffer bytes.Buffer
+			if _, err := io.Copy(&buffer, controlReader); err != nil {
+				return nil, err
+			}
+			return buffer.Bytes(), nil
+		}
+	}
+	return nil, fmt.Errorf("couldn't find control file")
+}
+
+func readDataTar(member string, reader io.Reader) ([]string, error) {
+	stream, err := decompress(member, reader)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var files []string
+
+	dataReader := tar.NewReader(stream)
+	for {
+		header, err := dataReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg, tar.TypeSymlink, tar.TypeLink:
+			files = append(files, strings.TrimPrefix(path.Clean("/"+header.Name), "/"))
+		}
+	}
+	return files, nil
+}
+
+func decompress(member string, reader io.Reader) (io.ReadCloser, error) {
+	switch ext := path.Ext(member); ext {
+	case ".tar":
+		return io.NopCloser(reader), nil
+	case ".xz":
+		stream, err := xz.NewReader(reader, 0)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(stream), nil
+	case ".gz":
+		return gzip.NewReader(reader)
+	case ".zst":
+		stream, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return stream.IOReadCloser(), nil
+	case ".bz2":
+		return io.NopCloser(bzip2.NewReader(reader)), nil
+	default:
+		return nil, fmt.Errorf("compression type %s not supported", ext)
+	}
+}
+
+func isUdeb(name string, idx *control.BinaryIndex) bool {
+	return path.Ext(name) == ".udeb" || idx.Values["Package-Type"] == "udeb"
+}
+
+// isDebugPackage reports whether the package holds detached debug symbols:
+// a .ddeb, a -dbgsym package built automatically by debhelper, or a package
+// declared in the debug section.
+func isDebugPackage(name string, idx *control.BinaryIndex) bool {
+	if path.Ext(name) == ".ddeb" {
+		return true
+	}
+	if strings.HasSuffix(idx.Package, "-dbgsym") && strings.TrimSpace(idx.Values["Auto-Built-Package"]) == "debug-symbols" {
+		return true
+	}
+	return path.Base(strings.TrimSpace(idx.Values["Section"])) == "debug"
+}
+
+func validateControl(name string, idx *control.BinaryIndex) error {
+	for _, field := range requiredControlFields {
+		if strings.TrimSpace(idx.Values[field]) == "" {
+			return fmt.Errorf("package %s: control file is missing %s field", name, field)
+		}
+	}
+	return nil
+}
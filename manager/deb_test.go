@@ -0,0 +1,210 @@
+package manager
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"github.com/akozlenkov/go-debian/control"
+	"github.com/blakesmith/ar"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+type arMember struct {
+	name string
+	data []byte
+}
+
+func arArchive(t *testing.T, members ...arMember) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := ar.NewWriter(&buf)
+	if err := w.WriteGlobalHeader(); err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range members {
+		if err := w.WriteHeader(&ar.Header{Name: member.name, ModTime: time.Unix(0, 0), Mode: 0o644, Size: int64(len(member.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(member.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// tarball archives files, given as name and content pairs, gzipped when the
+// name ends in .gz.
+func tarball(t *testing.T, name string, files ...string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		if err := tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0o644, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return buf.Bytes()
+	}
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return gz.Bytes()
+}
+
+// buildDeb returns a package with the given control file, installing the
+// given files.
+func buildDeb(t *testing.T, control string, files ...string) []byte {
+	t.Helper()
+
+	var data []string
+	for _, file := range files {
+		data = append(data, "./"+file, file)
+	}
+	return arArchive(t,
+		arMember{"debian-binary", []byte("2.0\n")},
+		arMember{"control.tar.gz", tarball(t, "control.tar.gz", "./control", control)},
+		arMember{"data.tar", tarball(t, "data.tar", data...)},
+	)
+}
+
+// writeDeb writes a package built with buildDeb to dir and returns its path.
+func writeDeb(t *testing.T, dir, name, control string, files ...string) string {
+	t.Helper()
+
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, buildDeb(t, control, files...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestReadDebFile(t *testing.T) {
+	const control = "Package: hello\nVersion: 1.0\nArchitecture: amd64\n"
+
+	deb, err := readDebFile("hello.deb", bytes.NewReader(buildDeb(t, control, "usr/bin/hello", "usr/share/doc/hello/copyright")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(deb.control) != control {
+		t.Errorf("control = %q, want %q", deb.control, control)
+	}
+	if want := []string{"usr/bin/hello", "usr/share/doc/hello/copyright"}; !slices.Equal(deb.files, want) {
+		t.Errorf("files = %q, want %q", deb.files, want)
+	}
+
+	var (
+		version  = arMember{"debian-binary", []byte("2.0\n")}
+		controls = arMember{"control.tar.gz", tarball(t, "control.tar.gz", "control", control)}
+		data     = arMember{"data.tar", tarball(t, "data.tar")}
+	)
+	for _, tt := range []struct {
+		name string
+		data []byte
+		err  string
+	}{
+		{
+			name: "signature member",
+			data: arArchive(t, version, controls, arMember{"_gpgorigin", []byte("signature")}, data),
+		},
+		{
+			name: "not an archive",
+			data: []byte("Package: hello\n"),
+			err:  "not a debian package",
+		},
+		{
+			name: "format version",
+			data: arArchive(t, arMember{"debian-binary", []byte("3.0\n")}, controls, data),
+			err:  `unsupported format version "3.0"`,
+		},
+		{
+			name: "missing data",
+			data: arArchive(t, version, controls),
+			err:  "missing data.tar member",
+		},
+		{
+			name: "members out of order",
+			data: arArchive(t, version, data, controls),
+			err:  "unexpected member data.tar, expected control.tar",
+		},
+		{
+			name: "missing control file",
+			data: arArchive(t, version, arMember{"control.tar.gz", tarball(t, "control.tar.gz", "md5sums", "")}, data),
+			err:  "couldn't find control file",
+		},
+		{
+			name: "unsupported compression",
+			data: arArchive(t, version, arMember{"control.tar.lz", nil}, data),
+			err:  "compression type .lz not supported",
+		},
+		{
+			name: "truncated",
+			data: buildDeb(t, control)[:100],
+			err:  "package hello.deb",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readDebFile("hello.deb", bytes.NewReader(tt.data))
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readDebFile() error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func readControl(t *testing.T, data string) *control.BinaryIndex {
+	t.Helper()
+
+	idx := new(control.BinaryIndex)
+	if err := control.Unmarshal(idx, bufio.NewReader(strings.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	return idx
+}
+
+func TestIsDebugPackage(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		control string
+		debug   bool
+	}{
+		{name: "hello_1.0_amd64.deb", control: "Package: hello\nSection: utils\n"},
+		{name: "hello-dbgsym_1.0_amd64.ddeb", control: "Package: hello-dbgsym\n", debug: true},
+		{name: "hello-dbgsym_1.0_amd64.deb", control: "Package: hello-dbgsym\nAuto-Built-Package: debug-symbols\n", debug: true},
+		{name: "hello-dbgsym_1.0_amd64.deb", control: "Package: hello-dbgsym\nSection: utils\n"},
+		{name: "hello-dbg_1.0_amd64.deb", control: "Package: hello-dbg\nSection: contrib/debug\n", debug: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			idx := readControl(t, tt.control)
+			if debug := isDebugPackage(tt.name, idx); debug != tt.debug {
+				t.Errorf("isDebugPackage(%q) = %t, want %t", tt.name, debug, tt.debug)
+			}
+		})
+	}
+}
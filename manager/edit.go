@@ -0,0 +1,309 @@
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"path"
+	"slices"
+	"strings"
+)
+
+type RepoChanges struct {
+	AddComponents       []string
+	RemoveComponents    []string
+	AddArchitectures    []string
+	RemoveArchitectures []string
+}
+
+func (m *Manager) EditRepo(suite string, opts ReleaseOptions, changes RepoChanges) error {
+	suite, ok := m.repoKey(suite)
+	if !ok {
+		return fmt.Errorf("repository %s not found", suite)
+	}
+
+	release, err := m.getRelease(suite)
+	if err != nil {
+		return err
+	}
+
+	architectures := slices.Clone(release.Architectures)
+
+	changes.AddArchitectures, err = canonicalArchitectures(changes.AddArchitectures)
+	if err != nil {
+		return err
+	}
+
+	if err := checkComponents(changes.AddComponents); err != nil {
+		return err
+	}
+	if err := checkChanges("component", release.Components, changes.AddComponents, changes.RemoveComponents); err != nil {
+		return err
+	}
+	if err := checkChanges("architecture", architectures, changes.AddArchitectures, changes.RemoveArchitectures); err != nil {
+		return err
+	}
+
+	if opts.ValidFor != nil {
+		if err := m.checkValidFor(suite, *opts.ValidFor); err != nil {
+			return err
+		}
+	}
+
+	archAll := release.NoSupportForArchitectureAll
+	opts.Apply(release)
+
+	for _, component := range changes.RemoveComponents {
+		if err := m.removeComponent(release, component); err != nil {
+			return err
+		}
+		release.Components = slices.DeleteFunc(release.Components, func(c string) bool { return c == component })
+	}
+
+	for _, arch := range changes.RemoveArchitectures {
+		if err := m.removeArchitecture(release, arch); err != nil {
+			return err
+		}
+		release.Architectures = slices.DeleteFunc(release.Architectures, func(a string) bool { return a == arch })
+		architectures = slices.DeleteFunc(architectures, func(a string) bool { return a == arch })
+	}
+
+	for _, arch := range changes.AddArchitectures {
+		if err := m.addArchitecture(release, architectures, arch); err != nil {
+			return err
+		}
+		release.Architectures = append(release.Architectures, arch)
+	}
+	architectures = append(architectures, changes.AddArchitectures...)
+
+	for _, component := range changes.AddComponents {
+		if err := m.createComponent(suite, component, architectures); err != nil {
+			return err
+		}
+		release.Components = append(release.Components, component)
+	}
+
+	if release.NoSupportForArchitectureAll != archAll {
+		for _, component := range release.Components {
+			if err := m.moveArchAllContents(release, component); err != nil {
+				return err
+			}
+		}
+	}
+
+	return m.rebuildRelease(release)
+}
+
+// moveArchAllContents adds the Contents-all entries to every Contents-<arch>
+// of component, or takes them out, after No-Support-for-Architecture-all was
+// toggled.
+func (m *Manager) moveArchAllContents(release *Release, component string) error {
+	c := make(map[string]contents)
+	indexes := make(map[string][]control.BinaryIndex)
+	for _, arch := range append([]string{"all"}, release.Architectures...) {
+		files, err := m.getContents(path.Join(DistsDir, release.Dir(), component, ContentsFile+"-"+arch+".gz"))
+		if err != nil {
+			return err
+		}
+		c[arch] = files
+
+		if arch == "all" {
+			continue
+		}
+		if indexes[arch], err = m.getBinaryIndexes(path.Join(DistsDir, release.Dir(), component, "binary-"+arch, PackagesFile)); err != nil {
+			return err
+		}
+	}
+
+	withArchAll(c, indexes, release.NoSupportForArchitectureAll != "")
+	return m.writeContents(release.Dir(), component, c)
+}
+
+func checkChanges(kind string, current, add, remove []string) error {
+	for _, v := range add {
+		if slices.Contains(current, v) {
+			return fmt.Errorf("%s %s already exists", kind, v)
+		}
+	}
+	for _, v := range remove {
+		if !slices.Contains(current, v) {
+			return fmt.Errorf("%s %s not found", kind, v)
+		}
+	}
+	if len(remove) != 0 && len(remove) == len(current) && len(add) == 0 {
+		return fmt.Errorf("can't remove every %s", kind)
+	}
+	return nil
+}
+
+func (m *Manager) addArchitecture(release *Release, existing []string, arch string) error {
+	settings, err := m.suiteSettings(release.Dir())
+	if err != nil {
+		return err
+	}
+
+	for _, component := range release.Components {
+		var (
+			packages []control.BinaryIndex
+			udebs    []control.BinaryIndex
+		)
+
+		if len(existing) != 0 {
+			indexes, err := m.getBinaryIndexes(path.Join(DistsDir, release.Dir(), component, "binary-"+existing[0], PackagesFile))
+			if err != nil {
+				return err
+			}
+			packages = architectureAll(indexes)
+
+			p := path.Join(DistsDir, release.Dir(), component, DebianInstallerDir, "binary-"+existing[0], PackagesFile)
+			if m.storage.Exists(p) {
+				indexes, err := m.getBinaryIndexes(p)
+				if err != nil {
+					return err
+				}
+				udebs = architectureAll(indexes)
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := MarshalPackages(&buf, packages...); err != nil {
+			return err
+		}
+		if err := m.writeIndex(path.Join(DistsDir, release.Dir(), component, "binary-"+arch, PackagesFile), buf.Bytes(), settings.Compression); err != nil {
+			return err
+		}
+
+		if len(udebs) != 0 {
+			buf.Reset()
+			if err := MarshalPackages(&buf, udebs...); err != nil {
+				return err
+			}
+			if err := m.writeIndex(path.Join(DistsDir, release.Dir(), component, DebianInstallerDir, "binary-"+arch, PackagesFile), buf.Bytes(), settings.Compression); err != nil {
+				return err
+			}
+		}
+
+		// The new architecture has no packages of its own yet, so its
+		// contents are exactly Contents-all when that is listed everywhere.
+		all := path.Join(DistsDir, release.Dir(), component, ContentsFile+"-all.gz")
+		if release.NoSupportForArchitectureAll != "" && m.storage.Exists(all) {
+			if err := m.copyFile(all, path.Join(DistsDir, release.Dir(), component, ContentsFile+"-"+arch+".gz")); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := m.writeContents(release.Dir(), component, map[string]contents{arch: make(contents)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) removeArchitecture(release *Release, arch string) error {
+	var errs []error
+
+	for _, component := range release.Components {
+		for _, dir := range []string{"", DebianInstallerDir} {
+			p := path.Join(DistsDir, release.Dir(), component, dir, "binary-"+arch, PackagesFile)
+			if !m.storage.Exists(p) {
+				continue
+			}
+
+			indexes, err := m.getBinaryIndexes(p)
+			if err != nil {
+				return err
+			}
+			for _, index := range indexes {
+				if packageArch(&index) != "all" {
+					if err := m.storage.Remove(index.Filename); err != nil {
+						errs = append(errs, fmt.Errorf("remove %s: %w", index.Filename, err))
+					}
+				}
+			}
+
+			if err := m.removeIndexes(path.Dir(p) + "/"); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		p := path.Join(DistsDir, release.Dir(), component, ContentsFile+"-"+arch+".gz")
+		if m.storage.Exists(p) {
+			if err := m.storage.Remove(p); err != nil {
+				errs = append(errs, fmt.Errorf("remove %s: %w", p, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m *Manager) removeComponent(release *Release, component string) error {
+	var nested []string
+	for _, c := range release.Components {
+		if strings.HasPrefix(c, component+"/") {
+			nested = append(nested, c)
+		}
+	}
+
+	var errs []error
+	for _, dir := range []string{DistsDir, PoolDir} {
+		prefix := path.Join(dir, release.Dir(), component) + "/"
+
+		if len(nested) == 0 && dir == PoolDir {
+			if _, err := m.storage.RemoveAll(prefix); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if err := m.storage.Walk(prefix, func(found string, err error) error {
+			if err != nil {
+				return err
+			}
+			if dir == DistsDir && isByHash(found) {
+				return nil
+			}
+			for _, c := range nested {
+				if strings.HasPrefix(found, path.Join(dir, release.Dir(), c)+"/") {
+					return nil
+				}
+			}
+			if err := m.storage.Remove(found); err != nil {
+				errs = append(errs, fmt.Errorf("remove %s: %w", found, err))
+			}
+			return nil
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeIndexes removes the indices under prefix. Their by-hash objects stay
+// until publishByHash ages them out, for clients holding an older InRelease.
+func (m *Manager) removeIndexes(prefix string) error {
+	var errs []error
+	if err := m.storage.Walk(prefix, func(found string, err error) error {
+		if err != nil {
+			return err
+		}
+		if isByHash(found) {
+			return nil
+		}
+		if err := m.storage.Remove(found); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s: %w", found, err))
+		}
+		return nil
+	}); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func architectureAll(indexes []control.BinaryIndex) []control.BinaryIndex {
+	return slices.DeleteFunc(indexes, func(index control.BinaryIndex) bool {
+		return packageArch(&index) != "all"
+	})
+}
@@ -0,0 +1,45 @@
+package manager
+
+// EventKind tells what an Event reports.
+type EventKind int
+
+const (
+	// EventWarning reports a problem that didn't stop the operation, such as
+	// a signature that doesn't verify with signature_check set to warn.
+	EventWarning EventKind = iota
+	// EventPackageUploaded reports a package written to the pool, or found
+	// there already.
+	EventPackageUploaded
+	// EventPackageRemoved reports a package pruned from the pool.
+	EventPackageRemoved
+	// EventRepoResigned reports a repository whose Release was signed again.
+	EventRepoResigned
+	// EventFilePublished reports a key or sources file written by
+	// PublishKeys.
+	EventFilePublished
+)
+
+// Event reports the progress of a Manager operation.
+type Event struct {
+	Kind  EventKind
+	Suite string
+	// Path is the package or file the event is about, if any.
+	Path string
+	Err  error
+}
+
+// SetEventHandler sets the function receiving the events of the Manager's
+// operations, one at a time. Without a handler events are dropped.
+func (m *Manager) SetEventHandler(handler func(Event)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = handler
+}
+
+func (m *Manager) emit(e Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.events != nil {
+		m.events(e)
+	}
+}
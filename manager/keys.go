@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/akozlenkov/faptly/pgp"
+	"path"
+	"strings"
+)
+
+const (
+	KeysDir    = "keys"
+	SourcesDir = "sources"
+)
+
+// ExportKeys returns the public keys of the configured signer, armored and
+// as a binary keyring suitable for Signed-By.
+func (m *Manager) ExportKeys() ([]byte, []byte, error) {
+	return exportKeys(m.signer, fmt.Sprintf("signer %s", m.config.Signer.Type))
+}
+
+func exportKeys(signer pgp.Signer, name string) ([]byte, []byte, error) {
+	exporter, ok := signer.(pgp.PublicKeyExporter)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s can't export public keys", name)
+	}
+
+	keyring, err := exporter.PublicKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	armored, err := pgp.ArmorPublicKeys(keyring)
+	if err != nil {
+		return nil, nil, err
+	}
+	return armored, keyring, nil
+}
+
+// PublishKeys writes the public keyring to keys/<name>.gpg and .asc and, when
+// url is set, a deb822 sources/<codename>.sources file for every repository
+// with Signed-By pointing at signedBy, /etc/apt/keyrings/<name>.gpg by
+// default. A repository signed with other keys gets its own
+// keys/<name>-<codename>.gpg and .asc, and a Signed-By named after them.
+func (m *Manager) PublishKeys(name, url, signedBy string) error {
+	armored, keyring, err := m.ExportKeys()
+	if err != nil {
+		return err
+	}
+	if err := m.publishKeyring(name, "", armored, keyring); err != nil {
+		return err
+	}
+
+	if url == "" {
+		return nil
+	}
+	if signedBy == "" {
+		signedBy = "/etc/apt/keyrings/" + name + ".gpg"
+	}
+
+	suites, err := m.suites()
+	if err != nil {
+		return err
+	}
+
+	for _, suite := range suites {
+		release, err := m.getRelease(suite)
+		if err != nil {
+			return err
+		}
+
+		signer, err := m.signerFor(release.Dir())
+		if err != nil {
+			return err
+		}
+
+		repoSignedBy := signedBy
+		if signer != m.signer {
+			repoArmored, repoKeyring, err := exportKeys(signer, "signer of repository "+release.Dir())
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(repoKeyring, keyring) {
+				repoName := name + "-" + release.Dir()
+				if err := m.publishKeyring(repoName, release.Dir(), repoArmored, repoKeyring); err != nil {
+					return err
+				}
+				repoSignedBy = strings.TrimSuffix(signedBy, ".gpg") + "-" + release.Dir() + ".gpg"
+			}
+		}
+
+		sb := new(strings.Builder)
+		sb.WriteString("Types: deb\n")
+		sb.WriteString(fmt.Sprintf("URIs: %s\n", url))
+		sb.WriteString(fmt.Sprintf("Suites: %s\n", release.Dir()))
+		sb.WriteString(fmt.Sprintf("Components: %s\n", strings.Join(release.Components, " ")))
+		sb.WriteString(fmt.Sprintf("Signed-By: %s\n", repoSignedBy))
+
+		p := path.Join(SourcesDir, release.Dir()+".sources")
+		if err := m.writeFile(p, []byte(sb.String()), nil); err != nil {
+			return err
+		}
+		m.emit(Event{Kind: EventFilePublished, Suite: release.Dir(), Path: p})
+	}
+	return nil
+}
+
+func (m *Manager) publishKeyring(name, suite string, armored, keyring []byte) error {
+	for p, data := range map[string][]byte{
+		path.Join(KeysDir, name+".gpg"): keyring,
+		path.Join(KeysDir, name+".asc"): armored,
+	} {
+		if err := m.writeFile(p, data, nil); err != nil {
+			return err
+		}
+		m.emit(Event{Kind: EventFilePublished, Suite: suite, Path: p})
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"github.com/akozlenkov/faptly/config"
+	"github.com/akozlenkov/faptly/pgp"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPublishKeys(t *testing.T) {
+	c, _ := testRepo(t, "trixie")
+	other, _ := testKey(t)
+	c.Suites = map[string]config.SuiteConfig{
+		"forky": {SigningKeys: []config.SigningKey{{PrivateKey: other}}},
+	}
+
+	m := newTestManager(t, c)
+	if err := m.CreateRepo("Test", "forky", "Test", "forky", "Test", []string{"main"}, []string{"amd64"}, ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	var published []string
+	m.SetEventHandler(func(e Event) {
+		if e.Kind == EventFilePublished {
+			published = append(published, e.Path)
+		}
+	})
+	if err := m.PublishKeys("faptly", "https://apt.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, p := range []string{"keys/faptly.gpg", "keys/faptly.asc", "keys/faptly-forky.gpg", "keys/faptly-forky.asc", "sources/trixie.sources", "sources/forky.sources"} {
+		if !m.storage.Exists(p) {
+			t.Errorf("%s wasn't published", p)
+		}
+	}
+	if len(published) != 6 {
+		t.Errorf("published %q, want an event per file", published)
+	}
+
+	for codename, signedBy := range map[string]string{
+		"trixie": "/etc/apt/keyrings/faptly.gpg",
+		"forky":  "/etc/apt/keyrings/faptly-forky.gpg",
+	} {
+		data, err := m.storage.ReadFile(path.Join(SourcesDir, codename+".sources"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), "Signed-By: "+signedBy+"\n") {
+			t.Errorf("%s.sources =\n%s\nwant Signed-By %s", codename, data, signedBy)
+		}
+	}
+
+	// Each keyring verifies the Release of the repositories pointing at it.
+	for keyring, codename := range map[string]string{"keys/faptly.gpg": "trixie", "keys/faptly-forky.gpg": "forky"} {
+		keys, err := m.storage.ReadFile(keyring)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inRelease, err := m.storage.ReadFile(path.Join(DistsDir, codename, ReleaseFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := pgp.ReadKeyring(keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := verifier.Verify(inRelease); err != nil {
+			t.Errorf("%s doesn't verify %s: %v", keyring, codename, err)
+		}
+	}
+}
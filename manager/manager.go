@@ -1,11 +1,8 @@
 package manager
 
 import (
-	"archive/tar"
 	"bufio"
 	"bytes"
-	"compress/bzip2"
-	"compress/gzip"
 	"context"
 	"crypto/md5"
 	"crypto/sha1"
@@ -16,11 +13,7 @@ import (
 	"github.com/akozlenkov/faptly/pgp"
 	"github.com/akozlenkov/faptly/storage"
 	"github.com/akozlenkov/go-debian/control"
-	"github.com/akozlenkov/go-debian/dependency"
 	"github.com/akozlenkov/go-debian/hashio"
-	"github.com/blakesmith/ar"
-	"github.com/klauspost/compress/zstd"
-	"github.com/xi2/xz"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 	"hash"
@@ -43,329 +36,868 @@ const (
 	DistsDir     = "dists"
 	ReleaseFile  = "InRelease"
 	PackagesFile = "Packages"
+	ContentsFile = "Contents"
+
+	PlainReleaseFile     = "Release"
+	ReleaseSignatureFile = "Release.gpg"
+
+	DebianInstallerDir = "debian-installer"
+
+	I18nDir         = "i18n"
+	TranslationFile = "Translation-en"
 )
 
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.+~_-]*$`)
+
+// checkComponents refuses component names other than slash-separated
+// validName segments, so that none can reach outside the repository.
+func checkComponents(components []string) error {
+	for _, component := range components {
+		for _, segment := range strings.Split(component, "/") {
+			if !validName.MatchString(segment) {
+				return fmt.Errorf("invalid component name %q", component)
+			}
+		}
+	}
+	return nil
+}
+
+// Manager publishes repositories to a storage. It caches the settings,
+// signers and suite aliases it reads and never rereads them, so a Manager is
+// meant to be short-lived: call Reset before reusing it once someone else may
+// have changed the repositories. The caches are safe to share between
+// goroutines, but concurrent operations on the same repository are not.
 type Manager struct {
-	mu      sync.Mutex
-	index   map[string][]control.BinaryIndex
+	mu     sync.Mutex
+	events func(Event)
+
+	// cacheMu guards the caches below.
+	cacheMu sync.Mutex
+
 	config  *config.Config
 	storage storage.Storage
+	signer  pgp.Signer
+	options pgp.SignOptions
+
+	keyring    *pgp.Keyring
+	settings   map[string]config.SuiteConfig
+	signers    map[string]pgp.Signer
+	dirOptions map[string]pgp.SignOptions
+	aliases    map[string]string
 }
 
 func New(c *config.Config) (*Manager, error) {
-	s, err := storage.New(c.S3Endpoint, c.S3Bucket, c.S3AccessKey, c.S3SecretKey)
+	var (
+		s   storage.Storage
+		err error
+	)
+
+	if c.FSRoot != "" {
+		s, err = storage.NewFilesystem(c.FSRoot)
+	} else {
+		s, err = storage.New(c.S3Endpoint, c.S3Bucket, c.S3Prefix, c.S3AccessKey, c.S3SecretKey)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return &Manager{
-		index:   make(map[string][]control.BinaryIndex),
+	opts, err := signOptions(c.Signer)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newSigner(c.Signer, c.Keys(), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
 		config:  c,
 		storage: s,
-	}, nil
+		signer:  signer,
+		options: opts,
+	}
+	m.Reset()
+	return m, nil
 }
 
-func (m *Manager) ListRepos() error {
-	sb := new(strings.Builder)
-	if err := m.storage.Walk(path.Join(DistsDir), func(path string, err error) error {
-		if err != nil {
-			return err
-		}
+// Reset drops the cached settings, signers, aliases and keyring, so that
+// they are read again from the storage.
+func (m *Manager) Reset() {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+
+	m.keyring = nil
+	m.settings = make(map[string]config.SuiteConfig)
+	m.signers = make(map[string]pgp.Signer)
+	m.dirOptions = make(map[string]pgp.SignOptions)
+	m.aliases = make(map[string]string)
+}
 
-		if match, err := regexp.MatchString(`dists/(\w+)/InRelease$`, path); err == nil && match {
-			release := new(Release)
+func signOptions(c config.SignerConfig) (pgp.SignOptions, error) {
+	hash, err := pgp.ParseHash(c.Hash)
+	if err != nil {
+		return pgp.SignOptions{}, err
+	}
 
-			file, err := m.storage.ReadFile(path)
-			if err != nil {
-				return err
-			}
+	clock, err := pgp.ParseTime(c.Time)
+	if err != nil {
+		return pgp.SignOptions{}, err
+	}
 
-			if err := control.Unmarshal(release, bytes.NewReader(file)); err != nil {
-				return err
-			}
+	return pgp.SignOptions{
+		Hash: hash,
+		Time: clock,
+	}, nil
+}
 
-			architectures := make([]string, 0, len(release.Architectures))
-			for _, arch := range release.Architectures {
-				architectures = append(architectures, arch.CPU)
-			}
-			sb.WriteString(fmt.Sprintf(
-				" * %s [%s] (%s): %s\n",
-				release.Suite,
-				strings.Join(release.Components, ", "),
-				strings.Join(architectures, "|"),
-				release.Description),
-			)
+func newSigner(c config.SignerConfig, signingKeys []config.SigningKey, opts pgp.SignOptions) (pgp.Signer, error) {
+	switch c.Type {
+	case "", config.SignerKey:
+		keys := make([]pgp.Key, 0, len(signingKeys))
+		for _, k := range signingKeys {
+			keys = append(keys, pgp.Key{
+				PrivateKey: []byte(k.PrivateKey),
+				Passphrase: []byte(k.Passkey),
+				KeyID:      k.KeyID,
+			})
 		}
-
-		return nil
-	}); err != nil {
-		return err
+		return pgp.NewKeySigner(keys, opts), nil
+	case config.SignerGPG:
+		return pgp.NewGPGSigner(c.GPGBinary, c.GPGHomedir, c.KeyIDs, opts), nil
+	case config.SignerCommand:
+		return pgp.NewCommandSigner(c.Command, []byte(c.PublicKey), opts), nil
+	case config.SignerSocket:
+		return pgp.NewSocketSigner(c.Socket, []byte(c.PublicKey), opts), nil
+	default:
+		return nil, fmt.Errorf("unknown signer type %s", c.Type)
 	}
+}
 
-	if sb.Len() != 0 {
-		fmt.Printf("List of repositories:\n%s\nTo get more information about local repository, run `faptly repo show <codename>`.\n", sb.String())
-	} else {
-		fmt.Printf("No repositories found, create one with `faptly repo create ...`.\n")
+// ConfigChecks returns the checks config.Validate needs for the settings
+// interpreted by the storage and pgp packages.
+func ConfigChecks() config.Checks {
+	return config.Checks{
+		Endpoint: func(endpoint string) error {
+			_, _, err := storage.ParseEndpoint(endpoint)
+			return err
+		},
+		Hash: func(name string) error {
+			_, err := pgp.ParseHash(name)
+			return err
+		},
+		Time: func(source string) error {
+			_, err := pgp.ParseTime(source)
+			return err
+		},
+		Keyring: func(keyring string) error {
+			_, err := pgp.ReadKeyring([]byte(keyring))
+			return err
+		},
+		Key: func(k config.SigningKey) error {
+			return pgp.CheckKey(pgp.Key{
+				PrivateKey: []byte(k.PrivateKey),
+				Passphrase: []byte(k.Passkey),
+				KeyID:      k.KeyID,
+			})
+		},
+		HasKey: func(k config.SigningKey, keyID string) bool {
+			return pgp.HasKey([]byte(k.PrivateKey), keyID)
+		},
 	}
-
-	return nil
 }
 
-func (m *Manager) ShowRepo(suite string) error {
-	if m.repoExists(suite) {
-		release := new(Release)
+// ListRepos returns the Release of every repository, suite aliases excluded.
+func (m *Manager) ListRepos() ([]*Release, error) {
+	suites, err := m.suites()
+	if err != nil {
+		return nil, err
+	}
 
-		file, err := m.storage.ReadFile(path.Join(DistsDir, suite, ReleaseFile))
+	releases := make([]*Release, 0, len(suites))
+	for _, suite := range suites {
+		release, err := m.getRelease(suite)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
 
-		if err := control.Unmarshal(release, bytes.NewReader(file)); err != nil {
-			return err
+// ShowRepo returns the Release of a repository looked up by codename or
+// suite.
+func (m *Manager) ShowRepo(suite string) (*Release, error) {
+	if suite, ok := m.repoKey(suite); ok {
+		return m.getRelease(suite)
+	}
+
+	return nil, fmt.Errorf("repository %s not found", suite)
+}
+
+func (m *Manager) CreateRepo(origin, suite, label, codename, description string, components []string, architectures []string, opts ReleaseOptions) error {
+	for _, name := range []string{suite, codename} {
+		if !validName.MatchString(name) {
+			return fmt.Errorf("invalid repository name %q", name)
 		}
+	}
+	if err := checkComponents(components); err != nil {
+		return err
+	}
 
-		return control.Marshal(os.Stdout, release)
+	architectures, err := canonicalArchitectures(architectures)
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("repository %s not found", suite)
-}
+	if opts.ValidFor != nil {
+		if err := m.checkValidFor(codename, *opts.ValidFor); err != nil {
+			return err
+		}
+	}
 
-func (m *Manager) CreateRepo(origin, suite, label, codename, description string, components []string, architectures []string) error {
-	if !m.repoExists(suite) {
-		for _, component := range components {
-			for _, arch := range architectures {
-				if err := m.storage.WriteFile(path.Join(DistsDir, suite, component, "binary-"+arch, PackagesFile), []byte{}); err != nil {
-					return err
-				}
+	if !m.repoExists(codename) {
+		if suite != codename {
+			if err := m.checkAlias(suite, codename); err != nil {
+				return err
 			}
 		}
 
-		arch := make([]dependency.Arch, len(architectures))
-		for i, a := range architectures {
-			arch[i] = dependency.Arch{
-				OS:  OS,
-				ABI: ABI,
-				CPU: a,
+		for _, component := range components {
+			if err := m.createComponent(codename, component, architectures); err != nil {
+				return err
 			}
 		}
 
-		return m.rebuildRelease(&Release{
+		release := &Release{
 			Origin:        origin,
 			Label:         label,
 			Suite:         suite,
 			Codename:      codename,
 			Components:    components,
 			Description:   description,
-			Architectures: arch,
-		})
+			Architectures: architectures,
+			dir:           codename,
+		}
+		opts.Apply(release)
+
+		return m.rebuildRelease(release)
 	}
-	return fmt.Errorf("repository %s already exists", suite)
+	return fmt.Errorf("repository %s already exists", codename)
 }
 
-func (m *Manager) DeleteRepo(suite string) error {
-	if m.repoExists(suite) {
-		for _, dir := range []string{PoolDir, DistsDir} {
-			if err := m.storage.RemoveAll(path.Join(dir, suite)); err != nil {
-				return err
-			}
+func (m *Manager) ResignRepos(suites []string, expiringWithin time.Duration) error {
+	if len(suites) == 0 {
+		all, err := m.suites()
+		if err != nil {
+			return err
 		}
-		return nil
+		suites = all
 	}
-	return fmt.Errorf("repository %s not found", suite)
-}
 
-func (m *Manager) ListPkgs(suite, component, architecture string) error {
-	sb := new(strings.Builder)
-	if m.repoExists(suite) {
+	for _, suite := range suites {
+		suite, ok := m.repoKey(suite)
+		if !ok {
+			return fmt.Errorf("repository %s not found", suite)
+		}
+
 		release, err := m.getRelease(suite)
 		if err != nil {
 			return err
 		}
 
-		if !slices.Contains(release.Components, component) {
-			return fmt.Errorf("unsuppored component")
+		if expiringWithin > 0 && (release.ValidUntil.IsZero() || time.Until(release.ValidUntil.Time) > expiringWithin) {
+			continue
 		}
 
-		if !slices.Contains(release.Architectures, dependency.Arch{ABI: "gnu", OS: "linux", CPU: architecture}) {
-			return fmt.Errorf("unsuppored architecture")
+		if err := m.writeRelease(release); err != nil {
+			return err
 		}
+		m.emit(Event{Kind: EventRepoResigned, Suite: suite})
+	}
+
+	return nil
+}
 
-		indexes, err := m.getBinaryIndexes(path.Join(DistsDir, suite, component, "binary-"+architecture, PackagesFile))
+// DeleteRepo removes a repository, its pool and its alias, and returns how
+// many objects were removed, also when some of them couldn't be.
+func (m *Manager) DeleteRepo(suite string) (int, error) {
+	if suite, ok := m.repoKey(suite); ok {
+		var (
+			removed int
+			errs    []error
+		)
+
+		release, err := m.getRelease(suite)
 		if err != nil {
-			return err
+			return 0, err
 		}
 
-		for _, index := range indexes {
-			sb.WriteString(fmt.Sprintf(" - %s\n", filepath.Base(index.Filename)))
+		var prefixes []string
+		if release.Suite != suite && m.aliasOf(release.Suite) == suite {
+			prefixes = append(prefixes, path.Join(DistsDir, release.Suite)+"/", path.Join(MetadataDir, release.Suite)+"/")
+			m.forgetAlias(release.Suite)
 		}
+		prefixes = append(prefixes, path.Join(PoolDir, suite)+"/", path.Join(DistsDir, suite)+"/", path.Join(MetadataDir, suite)+"/")
+		m.forgetAlias(suite)
 
-		if sb.Len() != 0 {
-			fmt.Printf("List of packages:\n%s\nTo get more information about package, run `faptly pkg show <package>`.\n", sb.String())
-		} else {
-			fmt.Printf("No packages found, upload one with `faptly pkg upload ...`.\n")
+		for _, prefix := range prefixes {
+			n, err := m.storage.RemoveAll(prefix)
+			removed += n
+			if err != nil {
+				errs = append(errs, err)
+			}
 		}
 
-		return nil
+		if len(errs) != 0 {
+			return removed, fmt.Errorf("repository %s partially deleted: %w", suite, errors.Join(errs...))
+		}
+		return removed, nil
 	}
+	return 0, fmt.Errorf("repository %s not found", suite)
+}
 
-	return fmt.Errorf("repository %s not found", suite)
+// ListPkgs returns the packages of a component for the architectures
+// matching architecture, which may be a wildcard such as linux-any.
+func (m *Manager) ListPkgs(suite, component, architecture string) ([]control.BinaryIndex, error) {
+	if suite, ok := m.repoKey(suite); ok {
+		release, err := m.getRelease(suite)
+		if err != nil {
+			return nil, err
+		}
+
+		architectures, err := packageArchitectures(release, component, architecture)
+		if err != nil {
+			return nil, err
+		}
+
+		return m.getArchitecturesIndexes(suite, component, architectures)
+	}
+
+	return nil, fmt.Errorf("repository %s not found", suite)
 }
 
-func (m *Manager) ShowPkg(suite, component, architecture, pkg string) error {
-	if m.repoExists(suite) {
+// ShowPkg returns the index entry of the package file pkg, with its full
+// description restored.
+func (m *Manager) ShowPkg(suite, component, architecture, pkg string) (*control.BinaryIndex, error) {
+	if suite, ok := m.repoKey(suite); ok {
 		release, err := m.getRelease(suite)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		if !slices.Contains(release.Components, component) {
-			return fmt.Errorf("unsuppored component")
+		architectures, err := packageArchitectures(release, component, architecture)
+		if err != nil {
+			return nil, err
 		}
 
-		if !slices.Contains(release.Architectures, dependency.Arch{ABI: "gnu", OS: "linux", CPU: architecture}) {
-			return fmt.Errorf("unsuppored architecture")
+		indexes, err := m.getArchitecturesIndexes(suite, component, architectures)
+		if err != nil {
+			return nil, err
 		}
 
-		indexes, err := m.getBinaryIndexes(path.Join(DistsDir, suite, component, "binary-"+architecture, PackagesFile))
+		descriptions, err := m.getTranslations(suite, component)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		restoreDescriptions(indexes, descriptions)
 
-		for _, index := range indexes {
+		for i, index := range indexes {
 			if pkg == filepath.Base(index.Filename) {
-				return control.Marshal(os.Stdout, index)
+				return &indexes[i], nil
 			}
 		}
-		return nil
+		return nil, fmt.Errorf("package %s not found", pkg)
 	}
 
-	return fmt.Errorf("repository %s not found", suite)
+	return nil, fmt.Errorf("repository %s not found", suite)
+}
+
+func packageArchitectures(release *Release, component, architecture string) ([]string, error) {
+	if !slices.Contains(release.Components, component) {
+		return nil, fmt.Errorf("unsuppored component")
+	}
+
+	architectures, err := matchArchitectures(release.Architectures, architecture)
+	if err != nil {
+		return nil, err
+	}
+	if len(architectures) == 0 {
+		return nil, fmt.Errorf("unsuppored architecture")
+	}
+	return architectures, nil
+}
+
+// upload is a package file read from disk and ready to be published.
+type upload struct {
+	name string
+	data []byte
+	deb  *debFile
+	idx  *control.BinaryIndex
+
+	// published is set when the pool already holds the file.
+	published bool
+}
+
+// uploadTarget holds the indices of one component while packages are added
+// to it.
+type uploadTarget struct {
+	release   *Release
+	component string
+	index     map[string][]control.BinaryIndex
+	udebIndex map[string][]control.BinaryIndex
+	contents  map[string]contents
+	uploads   []*upload
+	pruned    []string
 }
 
 func (m *Manager) UploadPkgs(suite string, component string, pkgs []string) error {
-	if m.repoExists(suite) {
-		r, err := m.getRelease(suite)
-		if err != nil {
-			return err
+	suite, ok := m.repoKey(suite)
+	if !ok {
+		return fmt.Errorf("repository %s doesn't exist", suite)
+	}
+
+	uploads, err := readPkgs(pkgs)
+	if err != nil {
+		return err
+	}
+
+	var (
+		targets  []*uploadTarget
+		releases []*Release
+	)
+
+	for _, u := range uploads {
+		targetSuite, targetComponent := suite, component
+		if (m.config.Debug.Suite != "" || m.config.Debug.Component != "") && isDebugPackage(u.name, u.idx) {
+			targetSuite, targetComponent = m.debugTarget(suite, component)
+			if key, ok := m.repoKey(targetSuite); ok {
+				targetSuite = key
+			} else {
+				return fmt.Errorf("repository %s doesn't exist", targetSuite)
+			}
 		}
 
-		for _, arch := range r.Architectures {
-			i, err := m.getBinaryIndexes(path.Join(DistsDir, suite, component, "binary-"+arch.CPU, PackagesFile))
+		i := slices.IndexFunc(targets, func(t *uploadTarget) bool {
+			return t.release.Dir() == targetSuite && t.component == targetComponent
+		})
+		if i < 0 {
+			j := slices.IndexFunc(releases, func(r *Release) bool { return r.Dir() == targetSuite })
+			if j < 0 {
+				r, err := m.getRelease(targetSuite)
+				if err != nil {
+					return err
+				}
+				releases = append(releases, r)
+				j = len(releases) - 1
+			}
+
+			t, err := m.loadUploadTarget(releases[j], targetComponent)
 			if err != nil {
 				return err
 			}
-			m.index[arch.CPU] = i
+			targets = append(targets, t)
+			i = len(targets) - 1
 		}
+		targets[i].uploads = append(targets[i].uploads, u)
+	}
 
-		sem := semaphore.NewWeighted(int64(runtime.NumCPU()))
-		group, ctx := errgroup.WithContext(context.Background())
+	// Everything is checked against the indices before the first object is
+	// written, so a refused package leaves the repositories untouched.
+	for _, t := range targets {
+		if err := t.add(); err != nil {
+			return err
+		}
+	}
 
-		for _, pkg := range pkgs {
-			func(pkg string) {
-				sem.Acquire(ctx, 1)
+	sem := semaphore.NewWeighted(int64(runtime.NumCPU()))
+	group, ctx := errgroup.WithContext(context.Background())
 
-				group.Go(func() error {
-					defer func() {
-						sem.Release(1)
-						fmt.Printf("Upload package %s\n", pkg)
-					}()
+	for _, t := range targets {
+		for _, u := range t.uploads {
+			sem.Acquire(ctx, 1)
 
-					idx := new(control.BinaryIndex)
+			group.Go(func() error {
+				defer sem.Release(1)
 
-					data, err := os.ReadFile(pkg)
-					if err != nil {
+				if !u.published {
+					if err := m.writeFile(u.idx.Filename, u.data, m.packageMetadata(u.idx)); err != nil {
 						return err
 					}
+				}
+				m.emit(Event{Kind: EventPackageUploaded, Suite: t.release.Dir(), Path: u.name})
+				return nil
+			})
+		}
+	}
 
-					reader := bytes.NewReader(data)
+	if err := group.Wait(); err != nil {
+		return err
+	}
 
-					rawIndex, err := readControlFile(reader)
-					if err != nil {
-						return err
-					}
+	for _, t := range targets {
+		settings, err := m.suiteSettings(t.release.Dir())
+		if err != nil {
+			return err
+		}
+		if n := settings.RetainVersions; n != nil && *n > 0 {
+			t.pruned = pruneVersions(*n, t.index, t.udebIndex)
+		}
 
-					if err := control.Unmarshal(idx, bufio.NewReader(bytes.NewReader(rawIndex))); err != nil {
-						return err
-					}
-					if idx.Architecture.CPU != "all" && !slices.Contains(r.Architectures, idx.Architecture) {
-						return fmt.Errorf("package %s has unsuported architecture %s", path.Base(pkg), idx.Architecture.CPU)
-					}
+		if err := m.writeContents(t.release.Dir(), t.component, t.contents); err != nil {
+			return err
+		}
+		if err := m.writeBinaryIndexes(t.release, t.component, t.index, t.udebIndex); err != nil {
+			return err
+		}
+	}
 
-					idx.Size = int(reader.Size())
-
-					_, hashers, err := hashio.NewHasherReaders([]string{"md5", "sha1", "sha256"}, reader)
-					for _, h := range hashers {
-						switch h.Name() {
-						case "md5":
-							idx.MD5sum = control.FileHashFromHasher(pkg, *h).Hash
-						case "sha1":
-							idx.SHA1 = control.FileHashFromHasher(pkg, *h).Hash
-						case "sha256":
-							idx.SHA256 = control.FileHashFromHasher(pkg, *h).Hash
-						}
-					}
+	for _, r := range releases {
+		if err := m.rebuildRelease(r); err != nil {
+			return err
+		}
+	}
 
-					if source, ok := idx.Values["Source"]; ok {
-						idx.Filename = path.Join(PoolDir, suite, component, strings.Split(source, "")[0], source, path.Base(pkg))
-					} else {
-						idx.Filename = path.Join(PoolDir, suite, component, strings.Split(idx.Package, "")[0], idx.Package, path.Base(pkg))
-					}
+	for _, t := range targets {
+		for _, file := range t.pruned {
+			if err := m.storage.Remove(file); err != nil {
+				return err
+			}
+			m.emit(Event{Kind: EventPackageRemoved, Suite: t.release.Dir(), Path: file})
+		}
+	}
+	return nil
+}
 
-					m.mu.Lock()
-
-					if idx.Architecture.CPU == "all" {
-						for _, arch := range r.Architectures {
-							for i, index := range m.index[arch.CPU] {
-								if path.Base(pkg) == path.Base(index.Filename) {
-									m.index[arch.CPU] = append(m.index[arch.CPU][:i], m.index[arch.CPU][i+1:]...)
-								}
-							}
-							m.index[arch.CPU] = append(m.index[arch.CPU], *idx)
-						}
-					} else {
-						for i, index := range m.index[idx.Architecture.CPU] {
-							if path.Base(pkg) == path.Base(index.Filename) {
-								m.index[idx.Architecture.CPU] = append(m.index[idx.Architecture.CPU][:i], m.index[idx.Architecture.CPU][i+1:]...)
-							}
-						}
-						m.index[idx.Architecture.CPU] = append(m.index[idx.Architecture.CPU], *idx)
-					}
+func (m *Manager) debugTarget(suite, component string) (string, string) {
+	replacer := strings.NewReplacer("{suite}", suite, "{component}", component)
+
+	debugSuite, debugComponent := suite, component
+	if m.config.Debug.Suite != "" {
+		debugSuite = replacer.Replace(m.config.Debug.Suite)
+	}
+	if m.config.Debug.Component != "" {
+		debugComponent = replacer.Replace(m.config.Debug.Component)
+	}
+	return debugSuite, debugComponent
+}
 
-					m.mu.Unlock()
+func (m *Manager) createComponent(suite, component string, architectures []string) error {
+	settings, err := m.suiteSettings(suite)
+	if err != nil {
+		return err
+	}
 
-					if err := m.storage.WriteFile(path.Join(idx.Filename), data); err != nil {
-						return err
-					}
-					return nil
-				})
-			}(pkg)
+	for _, arch := range architectures {
+		if err := m.writeIndex(path.Join(DistsDir, suite, component, "binary-"+arch, PackagesFile), []byte{}, settings.Compression); err != nil {
+			return err
+		}
+	}
+
+	empty := map[string]contents{"all": {}}
+	for _, arch := range architectures {
+		empty[arch] = contents{}
+	}
+	return m.writeContents(suite, component, empty)
+}
+
+// loadUploadTarget reads the indices of component, creating the component
+// when the release doesn't have it yet.
+func (m *Manager) loadUploadTarget(r *Release, component string) (*uploadTarget, error) {
+	suite := r.Dir()
+
+	if !slices.Contains(r.Components, component) {
+		if err := checkComponents([]string{component}); err != nil {
+			return nil, err
+		}
+		if err := m.createComponent(suite, component, r.Architectures); err != nil {
+			return nil, err
+		}
+		r.Components = append(r.Components, component)
+	}
+
+	t := &uploadTarget{
+		release:   r,
+		component: component,
+		index:     make(map[string][]control.BinaryIndex),
+		udebIndex: make(map[string][]control.BinaryIndex),
+		contents:  make(map[string]contents),
+	}
+
+	descriptions, err := m.getTranslations(suite, component)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, arch := range r.Architectures {
+		i, err := m.getBinaryIndexes(path.Join(DistsDir, suite, component, "binary-"+arch, PackagesFile))
+		if err != nil {
+			return nil, err
 		}
+		restoreDescriptions(i, descriptions)
+		t.index[arch] = i
 
-		if err := group.Wait(); err != nil {
+		p := path.Join(DistsDir, suite, component, DebianInstallerDir, "binary-"+arch, PackagesFile)
+		if !m.storage.Exists(p) {
+			continue
+		}
+		if t.udebIndex[arch], err = m.getBinaryIndexes(p); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, arch := range append([]string{"all"}, r.Architectures...) {
+		c, err := m.getContents(path.Join(DistsDir, suite, component, ContentsFile+"-"+arch+".gz"))
+		if err != nil {
+			return nil, err
+		}
+		t.contents[arch] = c
+	}
+	withArchAll(t.contents, t.index, r.NoSupportForArchitectureAll != "")
+
+	return t, nil
+}
+
+// add places the target's uploads in its indices.
+func (t *uploadTarget) add() error {
+	r := t.release
+
+	var err error
+	for _, u := range t.uploads {
+		idx := u.idx
+		name := path.Base(u.name)
+
+		arch := packageArch(idx)
+		if arch != "all" && !slices.Contains(r.Architectures, arch) {
+			return fmt.Errorf("package %s has unsuported architecture %s", name, arch)
+		}
+
+		if source, ok := idx.Values["Source"]; ok {
+			idx.Filename = path.Join(PoolDir, r.Dir(), t.component, strings.Split(source, "")[0], source, name)
+		} else {
+			idx.Filename = path.Join(PoolDir, r.Dir(), t.component, strings.Split(idx.Package, "")[0], idx.Package, name)
+		}
+
+		if u.published, err = publishedPackage(idx, t.index, t.udebIndex); err != nil {
+			return err
+		}
+
+		targets := []string{arch}
+		if arch == "all" {
+			targets = r.Architectures
+		}
+
+		if isUdeb(u.name, idx) {
+			for _, arch := range targets {
+				t.udebIndex[arch] = replaceIndex(t.udebIndex[arch], *idx)
+			}
+		} else {
+			for _, arch := range targets {
+				t.index[arch] = replaceIndex(t.index[arch], *idx)
+			}
+
+			if arch == "all" {
+				targets = []string{"all"}
+				if r.NoSupportForArchitectureAll != "" {
+					targets = append(targets, r.Architectures...)
+				}
+			}
+			location := contentsLocation(idx.Section, idx.Package)
+			for _, arch := range targets {
+				t.contents[arch].remove(idx.Package)
+				t.contents[arch].add(location, u.deb.files)
+			}
+		}
+	}
+	return nil
+}
+
+// readPkgs reads and hashes the package files, checking their control data.
+func readPkgs(pkgs []string) ([]*upload, error) {
+	uploads := make([]*upload, len(pkgs))
+
+	sem := semaphore.NewWeighted(int64(runtime.NumCPU()))
+	group, ctx := errgroup.WithContext(context.Background())
+
+	for i, pkg := range pkgs {
+		sem.Acquire(ctx, 1)
+
+		group.Go(func() error {
+			defer sem.Release(1)
+
+			u, err := readPkg(pkg)
+			if err != nil {
+				return err
+			}
+			uploads[i] = u
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+func readPkg(pkg string) (*upload, error) {
+	idx := new(control.BinaryIndex)
+
+	data, err := os.ReadFile(pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	deb, err := readDebFile(path.Base(pkg), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := control.Unmarshal(idx, bufio.NewReader(bytes.NewReader(deb.control))); err != nil {
+		return nil, fmt.Errorf("package %s: %w", path.Base(pkg), err)
+	}
+	if err := validateControl(path.Base(pkg), idx); err != nil {
+		return nil, err
+	}
+	if err := normalizeArch(idx); err != nil {
+		return nil, fmt.Errorf("package %s: %w", path.Base(pkg), err)
+	}
+
+	idx.Size = len(data)
+
+	hashReader, hashers, err := hashio.NewHasherReaders([]string{"md5", "sha1", "sha256"}, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, hashReader); err != nil {
+		return nil, err
+	}
+	for _, h := range hashers {
+		switch h.Name() {
+		case "md5":
+			idx.MD5sum = control.FileHashFromHasher(pkg, *h).Hash
+		case "sha1":
+			idx.SHA1 = control.FileHashFromHasher(pkg, *h).Hash
+		case "sha256":
+			idx.SHA256 = control.FileHashFromHasher(pkg, *h).Hash
+		}
+	}
+
+	return &upload{name: pkg, data: data, deb: deb, idx: idx}, nil
+}
+
+func (m *Manager) suites() ([]string, error) {
+	var suites []string
+
+	re := regexp.MustCompile(`^dists/([^/]+)/InRelease$`)
+	if err := m.storage.Walk(path.Join(DistsDir), func(path string, err error) error {
+		if err != nil {
 			return err
 		}
 
-		return m.writeBinaryIndexes(r, component, m.index)
+		if match := re.FindStringSubmatch(path); match != nil {
+			suites = append(suites, match[1])
+		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 
-	return fmt.Errorf("repository %s doesn't exist", suite)
+	return slices.DeleteFunc(suites, func(suite string) bool {
+		return m.aliasOf(suite) != ""
+	}), nil
 }
 
 func (m *Manager) repoExists(suite string) bool {
 	return m.storage.Exists(path.Join(DistsDir, suite, ReleaseFile))
 }
 
+// publishedPackage reports whether the pool already holds idx. Pool objects
+// are cached as immutable, so a different file under the same name is
+// refused rather than overwritten.
+func publishedPackage(idx *control.BinaryIndex, indexes ...map[string][]control.BinaryIndex) (bool, error) {
+	for _, index := range indexes {
+		for _, entries := range index {
+			for _, entry := range entries {
+				if entry.Filename != idx.Filename {
+					continue
+				}
+				if entry.SHA256 != idx.SHA256 {
+					return false, fmt.Errorf("package %s already exists with different contents, upload it with a new version", path.Base(idx.Filename))
+				}
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func replaceIndex(indexes []control.BinaryIndex, idx control.BinaryIndex) []control.BinaryIndex {
+	indexes = slices.DeleteFunc(indexes, func(index control.BinaryIndex) bool {
+		return path.Base(index.Filename) == path.Base(idx.Filename)
+	})
+	return append(indexes, idx)
+}
+
+func (m *Manager) writeFile(p string, data []byte, metadata map[string]string) error {
+	return m.storage.WriteFile(p, data, m.objectOptions(p, metadata))
+}
+
+// copyFile copies src to dst under the object policy of dst, which differs
+// from that of src for by-hash objects.
+func (m *Manager) copyFile(src, dst string) error {
+	return m.storage.Copy(src, dst, m.objectOptions(dst, nil))
+}
+
+func (m *Manager) objectOptions(p string, metadata map[string]string) storage.ObjectOptions {
+	policy := m.config.ObjectPolicies[objectClass(p)]
+
+	opts := storage.ObjectOptions{
+		ContentType:  policy.ContentType,
+		CacheControl: policy.CacheControl,
+		Metadata:     metadata,
+	}
+	if opts.ContentType == "" {
+		opts.ContentType = storage.ContentType(p)
+	}
+	return opts
+}
+
+func (m *Manager) packageMetadata(idx *control.BinaryIndex) map[string]string {
+	metadata := make(map[string]string, len(m.config.ObjectMetadata)+1)
+	for k, v := range m.config.ObjectMetadata {
+		metadata[k] = v
+	}
+	if m.config.ChecksumMetadata {
+		metadata["Sha256"] = idx.SHA256
+	}
+	return metadata
+}
+
+func objectClass(p string) string {
+	switch {
+	case strings.HasPrefix(p, PoolDir+"/"):
+		return config.ObjectClassPool
+	case strings.Contains(p, "/by-hash/"):
+		return config.ObjectClassByHash
+	case path.Base(p) == ReleaseFile, path.Base(p) == PlainReleaseFile, path.Base(p) == ReleaseSignatureFile:
+		return config.ObjectClassRelease
+	default:
+		return config.ObjectClassIndex
+	}
+}
+
 func (m *Manager) rebuildRelease(release *Release) error {
 	release.MD5 = make([]control.MD5FileHash, 0)
 	release.SHA1 = make([]control.SHA1FileHash, 0)
 	release.SHA256 = make([]control.SHA256FileHash, 0)
 
-	if err := m.storage.Walk(path.Join(DistsDir, release.Suite), func(found string, err error) error {
+	if err := m.storage.Walk(path.Join(DistsDir, release.Dir())+"/", func(found string, err error) error {
 		if err != nil {
 			return err
 		}
 
-		if !strings.HasSuffix(found, PackagesFile) {
+		if !isIndexFile(found) {
 			return nil
 		}
 
@@ -374,7 +906,7 @@ func (m *Manager) rebuildRelease(release *Release) error {
 			return err
 		}
 
-		p := strings.TrimPrefix(found, path.Join(DistsDir, release.Suite)+"/")
+		p := strings.TrimPrefix(found, path.Join(DistsDir, release.Dir())+"/")
 
 		hashers := []struct {
 			Name string
@@ -420,6 +952,10 @@ func (m *Manager) rebuildRelease(release *Release) error {
 		return err
 	}
 
+	if err := m.publishByHash(release); err != nil {
+		return err
+	}
+
 	return m.writeRelease(release)
 }
 
@@ -431,27 +967,148 @@ func (m *Manager) getRelease(suite string) (*Release, error) {
 		return nil, err
 	}
 
-	if err := control.Unmarshal(release, bytes.NewReader(data)); err != nil {
+	text, signatures, err := m.verifyRelease(data)
+	if err != nil {
+		if m.config.SignatureCheck != config.SignatureCheckWarn {
+			return nil, fmt.Errorf("repository %s: %w", suite, err)
+		}
+		m.emit(Event{Kind: EventWarning, Suite: suite, Err: err})
+		if text == nil {
+			text = data
+		}
+	}
+
+	if err := control.Unmarshal(release, bytes.NewReader(text)); err != nil {
 		return nil, err
 	}
+	release.dir = suite
+	release.signatures = signatures
 	return release, nil
 }
 
+// verifyRelease checks data against the keys of every configured signer,
+// since aliases and per-repository keys make the expected signer unknown
+// until the Release is parsed.
+func (m *Manager) verifyRelease(data []byte) ([]byte, []pgp.Signature, error) {
+	m.cacheMu.Lock()
+	keyring := m.keyring
+	m.cacheMu.Unlock()
+
+	if keyring == nil {
+		var (
+			signers  = []pgp.Signer{m.signer}
+			keyrings [][]byte
+			errs     []error
+		)
+		for name := range m.config.Suites {
+			signer, err := m.signerFor(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			signers = append(signers, signer)
+		}
+
+		for _, signer := range signers {
+			if exporter, ok := signer.(pgp.PublicKeyExporter); ok {
+				keys, err := exporter.PublicKeys()
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				keyrings = append(keyrings, keys)
+			}
+		}
+		if m.config.PublicGPGKey != "" {
+			keyrings = append(keyrings, []byte(m.config.PublicGPGKey))
+		}
+		if len(keyrings) == 0 && len(errs) != 0 {
+			return nil, nil, fmt.Errorf("no public keys to verify the signature with: %w", errors.Join(errs...))
+		}
+
+		var err error
+		if keyring, err = pgp.ReadKeyring(keyrings...); err != nil {
+			return nil, nil, err
+		}
+		m.cacheMu.Lock()
+		m.keyring = keyring
+		m.cacheMu.Unlock()
+	}
+
+	return keyring.Verify(data)
+}
+
 func (m *Manager) writeRelease(release *Release) error {
 	var buf bytes.Buffer
 
-	release.Date = Date{time.Now().UTC()}
+	validFor := release.ValidFor()
+
+	settings, err := m.suiteSettings(release.Dir())
+	if err != nil {
+		return err
+	}
+
+	signer, err := m.signerFor(release.Dir())
+	if err != nil {
+		return err
+	}
+	if err := m.checkValidFor(release.Dir(), validFor); err != nil {
+		return err
+	}
+
+	// A pinned signing time dates the Release too, so that a rebuild from
+	// the same indices produces the same bytes.
+	release.Paragraph = control.Paragraph{}
+	release.Date = Date{m.signOptionsFor(release.Dir()).Now().UTC().Truncate(time.Second)}
+	if validFor > 0 {
+		release.ValidUntil = Date{release.Date.Add(validFor)}
+	}
+
+	release.Paragraph, err = releaseParagraph(release, settings.ReleaseFields)
+	if err != nil {
+		return err
+	}
 
 	if err := control.Marshal(&buf, release); err != nil {
 		return err
 	}
 
-	data, err := pgp.SignData([]byte(m.config.PrivateGPGKey), []byte(m.config.PrivateGPGPasskey), buf.Bytes())
+	inRelease, signature, err := signer.Sign(buf.Bytes())
 	if err != nil {
 		return err
 	}
 
-	return m.storage.WriteFile(path.Join(DistsDir, release.Suite, ReleaseFile), data)
+	dir := path.Join(DistsDir, release.Dir())
+	if err := m.writeFile(path.Join(dir, PlainReleaseFile), buf.Bytes(), nil); err != nil {
+		return err
+	}
+	if err := m.writeFile(path.Join(dir, ReleaseSignatureFile), signature, nil); err != nil {
+		return err
+	}
+	if err := m.writeFile(path.Join(dir, ReleaseFile), inRelease, nil); err != nil {
+		return err
+	}
+
+	if release.Suite != "" && release.Suite != release.Dir() {
+		return m.syncAlias(release)
+	}
+	return nil
+}
+
+// checkValidFor refuses Valid-Until for repositories signed at a pinned time,
+// which also dates the Release: it would count from the pinned date rather
+// than from publication.
+func (m *Manager) checkValidFor(dir string, validFor time.Duration) error {
+	if validFor <= 0 {
+		return nil
+	}
+	if _, err := m.signerFor(dir); err != nil {
+		return err
+	}
+	if m.signOptionsFor(dir).Time != nil {
+		return fmt.Errorf("repository %s: valid_for can't be combined with a pinned signing time", dir)
+	}
+	return nil
 }
 
 func (m *Manager) getBinaryIndexes(p string) ([]control.BinaryIndex, error) {
@@ -467,80 +1124,118 @@ func (m *Manager) getBinaryIndexes(p string) ([]control.BinaryIndex, error) {
 	return binaryIndexes, nil
 }
 
-func (m *Manager) writeBinaryIndexes(release *Release, component string, indexes map[string][]control.BinaryIndex) error {
-	for k, index := range indexes {
-		var buf bytes.Buffer
+func (m *Manager) getArchitecturesIndexes(suite, component string, architectures []string) ([]control.BinaryIndex, error) {
+	var (
+		ret  []control.BinaryIndex
+		seen = make(map[string]bool)
+	)
+
+	for _, arch := range architectures {
+		indexes, err := m.getBinaryIndexes(path.Join(DistsDir, suite, component, "binary-"+arch, PackagesFile))
+		if err != nil {
+			return nil, err
+		}
+		for _, index := range indexes {
+			if !seen[index.Filename] {
+				seen[index.Filename] = true
+				ret = append(ret, index)
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (m *Manager) getTranslations(suite, component string) (map[string]string, error) {
+	p := path.Join(DistsDir, suite, component, I18nDir, TranslationFile)
+	if !m.storage.Exists(p) {
+		return map[string]string{}, nil
+	}
+
+	data, err := m.storage.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return parseTranslations(data)
+}
+
+func (m *Manager) getContents(p string) (contents, error) {
+	if !m.storage.Exists(p) {
+		return make(contents), nil
+	}
 
-		if err := control.Marshal(&buf, index); err != nil {
+	data, err := m.storage.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	return parseContents(data)
+}
+
+func (m *Manager) writeContents(suite, component string, c map[string]contents) error {
+	for arch, files := range c {
+		data, err := files.marshal()
+		if err != nil {
 			return err
 		}
 
-		if err := m.storage.WriteFile(path.Join(DistsDir, release.Suite, component, "binary-"+k, PackagesFile), buf.Bytes()); err != nil {
+		if err := m.writeFile(path.Join(DistsDir, suite, component, ContentsFile+"-"+arch+".gz"), data, nil); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	return m.rebuildRelease(release)
+func isIndexFile(p string) bool {
+	name := path.Base(p)
+	return strings.HasPrefix(name, PackagesFile) || strings.HasPrefix(name, ContentsFile+"-") || strings.HasPrefix(name, TranslationFile)
 }
 
-func readControlFile(reader io.Reader) ([]byte, error) {
-	archiveReader := ar.NewReader(reader)
+func (m *Manager) writeBinaryIndexes(release *Release, component string, indexes, udebIndexes map[string][]control.BinaryIndex) error {
+	settings, err := m.suiteSettings(release.Dir())
+	if err != nil {
+		return err
+	}
+
+	indexes, translations := splitDescriptions(indexes, m.config.SplitDescriptions)
+	udebIndexes, _ = splitDescriptions(udebIndexes, false)
+
+	for k, index := range udebIndexes {
+		var buf bytes.Buffer
 
-	for {
-		header, err := archiveReader.Next()
-		if err == io.EOF {
-			break
+		if err := MarshalPackages(&buf, index...); err != nil {
+			return err
 		}
-		if err != nil {
-			return nil, err
+
+		if err := m.writeIndex(path.Join(DistsDir, release.Dir(), component, DebianInstallerDir, "binary-"+k, PackagesFile), buf.Bytes(), settings.Compression); err != nil {
+			return err
 		}
+	}
 
-		if strings.HasPrefix(header.Name, "control.tar") {
-			var controlReader *tar.Reader
-			switch path.Ext(strings.Trim(header.Name, "/")) {
-			case ".xz":
-				stream, err := xz.NewReader(archiveReader, 0)
-				if err != nil {
-					panic(err)
-				}
-				controlReader = tar.NewReader(stream)
-			case ".gz":
-				stream, err := gzip.NewReader(archiveReader)
-				if err != nil {
-					panic(err)
-				}
-				controlReader = tar.NewReader(stream)
-			case ".zst":
-				stream, err := zstd.NewReader(archiveReader)
-				if err != nil {
-					panic(err)
-				}
-				controlReader = tar.NewReader(stream)
-			case ".bz2":
-				controlReader = tar.NewReader(bzip2.NewReader(archiveReader))
-			default:
-				return nil, fmt.Errorf("compression type %s not supported", path.Ext(strings.Trim(header.Name, "/")))
-			}
+	for k, index := range indexes {
+		var buf bytes.Buffer
 
-			for {
-				header, err := controlReader.Next()
-				if err == io.EOF {
-					break
-				}
-				if err != nil {
-					panic(err)
-				}
+		if err := MarshalPackages(&buf, index...); err != nil {
+			return err
+		}
 
-				if strings.HasSuffix(header.Name, "control") {
-					var buffer bytes.Buffer
-					_, err := io.Copy(bufio.NewWriter(&buffer), controlReader)
-					if err != nil {
-						return nil, err
-					}
-					return buffer.Bytes(), nil
-				}
-			}
+		if err := m.writeIndex(path.Join(DistsDir, release.Dir(), component, "binary-"+k, PackagesFile), buf.Bytes(), settings.Compression); err != nil {
+			return err
+		}
+	}
+
+	if m.config.SplitDescriptions {
+		var buf bytes.Buffer
+
+		if err := control.Marshal(&buf, translations); err != nil {
+			return err
+		}
+
+		compression := settings.Compression
+		if compression == nil {
+			compression = compressions
+		}
+		if err := m.writeIndex(path.Join(DistsDir, release.Dir(), component, I18nDir, TranslationFile), buf.Bytes(), compression); err != nil {
+			return err
 		}
 	}
-	return nil, errors.New("couldn't find control file in package")
+	return nil
 }
@@ -0,0 +1,187 @@
+package manager
+
+import (
+	"bytes"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"github.com/akozlenkov/faptly/config"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testKey returns a fresh armored private key and its public key.
+func testKey(t *testing.T) (string, string) {
+	t.Helper()
+
+	entity, err := openpgp.NewEntity("Test", "", "test@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var private, public bytes.Buffer
+	for _, key := range []struct {
+		buf       *bytes.Buffer
+		blockType string
+		serialize func(io.Writer) error
+	}{
+		{&private, openpgp.PrivateKeyType, func(w io.Writer) error { return entity.SerializePrivate(w, nil) }},
+		{&public, openpgp.PublicKeyType, entity.Serialize},
+	} {
+		w, err := armor.Encode(key.buf, key.blockType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := key.serialize(w); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return private.String(), public.String()
+}
+
+// testRepo creates a repository signed with a fresh key under a temporary
+// fs_root and returns the config used, along with the armored public key.
+func testRepo(t *testing.T, codename string) (*config.Config, string) {
+	t.Helper()
+
+	private, public := testKey(t)
+
+	c := config.New()
+	c.FSRoot = t.TempDir()
+	c.PrivateGPGKey = private
+
+	m := newTestManager(t, c)
+	if err := m.CreateRepo("Test", codename, "Test", codename, "Test", []string{"main"}, []string{"amd64"}, ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return c, public
+}
+
+func newTestManager(t *testing.T, c *config.Config) *Manager {
+	t.Helper()
+
+	m, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestVerifyRelease(t *testing.T) {
+	signed, public := testRepo(t, "trixie")
+
+	for _, tt := range []struct {
+		name    string
+		config  func(c *config.Config)
+		err     string
+		warning bool
+	}{
+		{
+			name:   "signing key",
+			config: func(c *config.Config) { c.PrivateGPGKey = signed.PrivateGPGKey },
+		},
+		{
+			name:   "public key only",
+			config: func(c *config.Config) { c.PublicGPGKey = public },
+		},
+		{
+			name: "command signer with public key",
+			config: func(c *config.Config) {
+				c.Signer = config.SignerConfig{Type: config.SignerCommand, Command: []string{"false"}, PublicKey: public}
+			},
+		},
+		{
+			name: "command signer without public key",
+			config: func(c *config.Config) {
+				c.Signer = config.SignerConfig{Type: config.SignerCommand, Command: []string{"false"}}
+			},
+			err: "no public keys to verify the signature with",
+		},
+		{
+			name: "socket signer with another key",
+			config: func(c *config.Config) {
+				other, _ := testRepo(t, "bookworm")
+				m := newTestManager(t, other)
+				armored, _, err := m.ExportKeys()
+				if err != nil {
+					t.Fatal(err)
+				}
+				c.Signer = config.SignerConfig{Type: config.SignerSocket, Socket: "/nonexistent", PublicKey: string(armored)}
+			},
+			err: "no signature by a known key",
+		},
+		{
+			name: "no keys",
+			err:  "no public keys to verify the signature with",
+		},
+		{
+			name:    "no keys with signature_check warn",
+			config:  func(c *config.Config) { c.SignatureCheck = config.SignatureCheckWarn },
+			warning: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config.New()
+			c.FSRoot = signed.FSRoot
+			if tt.config != nil {
+				tt.config(c)
+			}
+
+			m := newTestManager(t, c)
+			var warnings []Event
+			m.SetEventHandler(func(e Event) { warnings = append(warnings, e) })
+
+			release, err := m.getRelease("trixie")
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("getRelease() error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getRelease(): %v", err)
+			}
+			if release.Codename != "trixie" {
+				t.Errorf("Codename = %q, want trixie", release.Codename)
+			}
+			if got := len(warnings) != 0; got != tt.warning {
+				t.Errorf("warnings = %v, want warning %t", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+func TestCheckComponents(t *testing.T) {
+	for _, tt := range []struct {
+		components []string
+		valid      bool
+	}{
+		{components: []string{"main", "contrib", "non-free-firmware"}, valid: true},
+		{components: []string{"main/debug", "updates/main"}, valid: true},
+		{components: []string{"../../../x"}},
+		{components: []string{"main/../../x"}},
+		{components: []string{"main/"}},
+		{components: []string{"/main"}},
+		{components: []string{""}},
+		{components: []string{"main", "con trib"}},
+	} {
+		t.Run(strings.Join(tt.components, ","), func(t *testing.T) {
+			if err := checkComponents(tt.components); (err == nil) != tt.valid {
+				t.Errorf("checkComponents(%q) = %v, want valid %t", tt.components, err, tt.valid)
+			}
+		})
+	}
+
+	c, _ := testRepo(t, "trixie")
+	m := newTestManager(t, c)
+	if err := m.CreateRepo("Test", "forky", "Test", "forky", "Test", []string{"../../escape"}, []string{"amd64"}, ReleaseOptions{}); err == nil {
+		t.Error("CreateRepo() accepted a component outside the repository")
+	}
+	if err := m.UploadPkgs("trixie", "../../escape", []string{writeDeb(t, t.TempDir(), "hello_1.0_amd64.deb", "Package: hello\nVersion: 1.0\nArchitecture: amd64\n")}); err == nil {
+		t.Error("UploadPkgs() accepted a component outside the repository")
+	}
+}
@@ -1,22 +1,125 @@
 package manager
 
 import (
+	"github.com/akozlenkov/faptly/pgp"
 	"github.com/akozlenkov/go-debian/control"
-	"github.com/akozlenkov/go-debian/dependency"
+	"time"
 )
 
 type Release struct {
 	control.Paragraph
 
-	Origin        string
-	Suite         string
-	Label         string
-	Codename      string
-	Description   string
-	Components    []string
-	Architectures []dependency.Arch
-	Date          Date
-	MD5           []control.MD5FileHash    `control:"MD5Sum" multiline:"true" delim:"\n" strip:"\n\r\t "`
-	SHA1          []control.SHA1FileHash   `control:"SHA1" multiline:"true" delim:"\n" strip:"\n\r\t "`
-	SHA256        []control.SHA256FileHash `control:"SHA256" multiline:"true" delim:"\n" strip:"\n\r\t "`
+	Origin                      string
+	Suite                       string
+	Label                       string
+	Version                     string
+	Codename                    string
+	Changelogs                  string
+	Description                 string
+	Components                  []string
+	Architectures               []string
+	Date                        Date
+	ValidUntil                  Date                     `control:"Valid-Until"`
+	NotAutomatic                string                   `control:"NotAutomatic"`
+	ButAutomaticUpgrades        string                   `control:"ButAutomaticUpgrades"`
+	AcquireByHash               string                   `control:"Acquire-By-Hash"`
+	NoSupportForArchitectureAll string                   `control:"No-Support-for-Architecture-all"`
+	SignedBy                    string                   `control:"Signed-By"`
+	MD5                         []control.MD5FileHash    `control:"MD5Sum" multiline:"true" delim:"\n" strip:"\n\r\t "`
+	SHA1                        []control.SHA1FileHash   `control:"SHA1" multiline:"true" delim:"\n" strip:"\n\r\t "`
+	SHA256                      []control.SHA256FileHash `control:"SHA256" multiline:"true" delim:"\n" strip:"\n\r\t "`
+
+	dir      string        `control:"-"`
+	validFor time.Duration `control:"-"`
+
+	// prunedByHash lists the by-hash objects removed by the last rebuild, so
+	// that the suite alias drops them too.
+	prunedByHash []string `control:"-"`
+
+	signatures []pgp.Signature `control:"-"`
+}
+
+type ReleaseOptions struct {
+	Origin                      *string
+	Label                       *string
+	Description                 *string
+	Version                     *string
+	Changelogs                  *string
+	SignedBy                    *string
+	ValidFor                    *time.Duration
+	NotAutomatic                *bool
+	ButAutomaticUpgrades        *bool
+	AcquireByHash               *bool
+	NoSupportForArchitectureAll *bool
+}
+
+func (o ReleaseOptions) Apply(r *Release) {
+	for _, field := range []struct {
+		value  *string
+		target *string
+	}{
+		{o.Origin, &r.Origin},
+		{o.Label, &r.Label},
+		{o.Description, &r.Description},
+		{o.Version, &r.Version},
+		{o.Changelogs, &r.Changelogs},
+		{o.SignedBy, &r.SignedBy},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+
+	for _, field := range []struct {
+		value  *bool
+		target *string
+		set    string
+	}{
+		{o.NotAutomatic, &r.NotAutomatic, "yes"},
+		{o.ButAutomaticUpgrades, &r.ButAutomaticUpgrades, "yes"},
+		{o.AcquireByHash, &r.AcquireByHash, "yes"},
+		{o.NoSupportForArchitectureAll, &r.NoSupportForArchitectureAll, "Packages"},
+	} {
+		if field.value != nil {
+			*field.target = ""
+			if *field.value {
+				*field.target = field.set
+			}
+		}
+	}
+
+	if o.ValidFor != nil {
+		r.SetValidFor(*o.ValidFor)
+	}
+}
+
+func (r *Release) Dir() string {
+	switch {
+	case r.dir != "":
+		return r.dir
+	case r.Codename != "":
+		return r.Codename
+	default:
+		return r.Suite
+	}
+}
+
+// Signatures returns the verified signatures of the InRelease the Release was
+// read from.
+func (r *Release) Signatures() []pgp.Signature {
+	return r.signatures
+}
+
+func (r *Release) SetValidFor(d time.Duration) {
+	r.validFor = d
+	if d <= 0 {
+		r.ValidUntil = Date{}
+	}
+}
+
+func (r *Release) ValidFor() time.Duration {
+	if r.validFor == 0 && !r.ValidUntil.IsZero() {
+		return r.ValidUntil.Sub(r.Date.Time)
+	}
+	return r.validFor
 }
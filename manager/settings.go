@@ -0,0 +1,406 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/akozlenkov/faptly/config"
+	"github.com/akozlenkov/faptly/pgp"
+	"github.com/akozlenkov/go-debian/control"
+	"github.com/akozlenkov/go-debian/version"
+	"gopkg.in/yaml.v3"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Repository metadata lives outside dists/ and pool/, so that it isn't
+// served to clients along with the repository or copied into suite aliases.
+const (
+	MetadataDir  = ".faptly"
+	MetadataFile = "settings.yaml"
+)
+
+var compressions = []string{".gz", ".xz"}
+
+// suiteSettings merges the repository metadata object with the suites section
+// of the config, the config taking priority.
+func (m *Manager) suiteSettings(dir string) (config.SuiteConfig, error) {
+	m.cacheMu.Lock()
+	settings, ok := m.settings[dir]
+	m.cacheMu.Unlock()
+	if ok {
+		return settings, nil
+	}
+
+	settings, err := m.readMetadata(dir)
+	if err != nil {
+		return config.SuiteConfig{}, err
+	}
+	settings = settings.Merge(m.config.Suites[dir])
+
+	if err := checkCompression(settings.Compression); err != nil {
+		return config.SuiteConfig{}, fmt.Errorf("repository %s: %w", dir, err)
+	}
+
+	m.cacheMu.Lock()
+	m.settings[dir] = settings
+	m.cacheMu.Unlock()
+	return settings, nil
+}
+
+func checkCompression(compression []string) error {
+	for _, ext := range compression {
+		if ext != "" && !slices.Contains(compressions, ext) {
+			return fmt.Errorf("unsupported compression %q", ext)
+		}
+	}
+	return nil
+}
+
+func metadataPath(dir, name string) string {
+	return path.Join(MetadataDir, dir, name)
+}
+
+func (m *Manager) readMetadata(dir string) (config.SuiteConfig, error) {
+	var settings config.SuiteConfig
+
+	p := metadataPath(dir, MetadataFile)
+	if !m.storage.Exists(p) {
+		return settings, nil
+	}
+
+	data, err := m.storage.ReadFile(p)
+	if err != nil {
+		return settings, err
+	}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("%s: %w", p, err)
+	}
+
+	// Anyone able to write to the bucket can edit the metadata object, so it
+	// may pick among the configured keys but never bring its own keys or
+	// signer commands.
+	settings.SigningKeys = nil
+	settings.Signer = nil
+	return settings, nil
+}
+
+func (m *Manager) signerFor(dir string) (pgp.Signer, error) {
+	m.cacheMu.Lock()
+	signer, ok := m.signers[dir]
+	m.cacheMu.Unlock()
+	if ok {
+		return signer, nil
+	}
+
+	settings, err := m.suiteSettings(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := m.options
+	switch {
+	case settings.Signer != nil:
+		if opts, err = signOptions(*settings.Signer); err != nil {
+			return nil, err
+		}
+		keys := settings.SigningKeys
+		if keys == nil {
+			keys = m.config.Keys()
+		}
+		if signer, err = newSigner(*settings.Signer, keys, opts); err != nil {
+			return nil, err
+		}
+	case len(settings.SigningKeys) != 0 || len(settings.KeyIDs) != 0:
+		keys := settings.SigningKeys
+		if len(keys) == 0 {
+			if keys, err = m.selectKeys(settings.KeyIDs); err != nil {
+				return nil, fmt.Errorf("repository %s: %w", dir, err)
+			}
+		}
+		if signer, err = newSigner(config.SignerConfig{}, keys, opts); err != nil {
+			return nil, err
+		}
+	default:
+		signer = m.signer
+	}
+
+	m.cacheMu.Lock()
+	m.signers[dir] = signer
+	m.dirOptions[dir] = opts
+	m.cacheMu.Unlock()
+	return signer, nil
+}
+
+// signOptionsFor returns the sign options of the signer of dir, once
+// signerFor has loaded it.
+func (m *Manager) signOptionsFor(dir string) pgp.SignOptions {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	return m.dirOptions[dir]
+}
+
+// selectKeys finds the configured keys holding every key ID.
+func (m *Manager) selectKeys(keyIDs []string) ([]config.SigningKey, error) {
+	keys := make([]config.SigningKey, 0, len(keyIDs))
+	for _, id := range keyIDs {
+		i := slices.IndexFunc(m.config.Keys(), func(k config.SigningKey) bool {
+			return pgp.HasKey([]byte(k.PrivateKey), id)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("key %s not found in the configured keys", id)
+		}
+		key := m.config.Keys()[i]
+		key.KeyID = id
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// releaseParagraph places the extra fields after the standard ones set in
+// release and before the checksums.
+func releaseParagraph(release *Release, fields map[string]string) (control.Paragraph, error) {
+	if len(fields) == 0 {
+		return control.Paragraph{}, nil
+	}
+
+	var names, standard, checksums []string
+	v := reflect.ValueOf(release).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.Anonymous || !f.IsExported() {
+			continue
+		}
+		name := f.Tag.Get("control")
+		if name == "" {
+			name = f.Name
+		}
+		names = append(names, name)
+
+		// The paragraph order emits every listed field, set or not.
+		if field := v.Field(i); field.IsZero() || (field.Kind() == reflect.Slice && field.Len() == 0) {
+			continue
+		}
+		if f.Tag.Get("multiline") != "" {
+			checksums = append(checksums, name)
+		} else {
+			standard = append(standard, name)
+		}
+	}
+
+	extra := make([]string, 0, len(fields))
+	for name := range fields {
+		if slices.ContainsFunc(names, func(s string) bool { return strings.EqualFold(s, name) }) {
+			return control.Paragraph{}, fmt.Errorf("release field %s can't be overridden", name)
+		}
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+
+	return control.Paragraph{
+		Values: fields,
+		Order:  slices.Concat(standard, extra, checksums),
+	}, nil
+}
+
+// writeIndex writes an index uncompressed, which is what faptly reads back,
+// plus the configured compressed variants, removing the others.
+func (m *Manager) writeIndex(p string, data []byte, compression []string) error {
+	if err := m.writeFile(p, data, nil); err != nil {
+		return err
+	}
+
+	for _, ext := range compressions {
+		if !slices.Contains(compression, ext) {
+			if m.storage.Exists(p + ext) {
+				if err := m.storage.Remove(p + ext); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		compressed, err := compress(ext, data)
+		if err != nil {
+			return err
+		}
+		if err := m.writeFile(p+ext, compressed, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pruneVersions keeps the newest n versions of every package in the indexes
+// and returns the pool files no longer referenced by any of them.
+func pruneVersions(n int, indexes ...map[string][]control.BinaryIndex) []string {
+	referenced := func() map[string]bool {
+		files := make(map[string]bool)
+		for _, index := range indexes {
+			for _, entries := range index {
+				for _, entry := range entries {
+					files[entry.Filename] = true
+				}
+			}
+		}
+		return files
+	}
+
+	before := referenced()
+
+	for _, index := range indexes {
+		for arch, entries := range index {
+			byPackage := make(map[string][]control.BinaryIndex)
+			for _, entry := range entries {
+				byPackage[entry.Package] = append(byPackage[entry.Package], entry)
+			}
+
+			keep := make(map[string]bool)
+			for _, versions := range byPackage {
+				slices.SortStableFunc(versions, func(a, b control.BinaryIndex) int {
+					return version.Compare(b.Version, a.Version)
+				})
+				for _, v := range versions[:min(n, len(versions))] {
+					keep[v.Filename] = true
+				}
+			}
+
+			index[arch] = slices.DeleteFunc(entries, func(entry control.BinaryIndex) bool {
+				return !keep[entry.Filename]
+			})
+		}
+	}
+
+	after := referenced()
+
+	var removed []string
+	for file := range before {
+		if !after[file] {
+			removed = append(removed, file)
+		}
+	}
+	sort.Strings(removed)
+	return removed
+}
+
+// RepoSettings returns the effective settings of a repository with the
+// private keys redacted.
+func (m *Manager) RepoSettings(suite string) (config.SuiteConfig, error) {
+	dir, ok := m.repoKey(suite)
+	if !ok {
+		return config.SuiteConfig{}, fmt.Errorf("repository %s not found", suite)
+	}
+
+	settings, err := m.suiteSettings(dir)
+	if err != nil {
+		return config.SuiteConfig{}, err
+	}
+
+	keys := make([]config.SigningKey, len(settings.SigningKeys))
+	for i, k := range settings.SigningKeys {
+		keys[i] = config.SigningKey{PrivateKey: "<redacted>", KeyID: k.KeyID}
+	}
+	if settings.SigningKeys != nil {
+		settings.SigningKeys = keys
+	}
+	return settings, nil
+}
+
+// UpdateRepoSettings stores the fields set in changes in the repository
+// metadata object and re-signs the Release to apply them. A change of
+// compression rewrites the compressed indices first.
+func (m *Manager) UpdateRepoSettings(suite string, changes config.SuiteConfig) error {
+	dir, ok := m.repoKey(suite)
+	if !ok {
+		return fmt.Errorf("repository %s not found", suite)
+	}
+
+	if changes.Signer != nil || changes.SigningKeys != nil {
+		return fmt.Errorf("signers and signing keys can only be set in the config")
+	}
+
+	release, err := m.getRelease(dir)
+	if err != nil {
+		return err
+	}
+
+	current, err := m.suiteSettings(dir)
+	if err != nil {
+		return err
+	}
+
+	settings, err := m.readMetadata(dir)
+	if err != nil {
+		return err
+	}
+	settings = settings.Merge(changes)
+
+	if err := checkCompression(settings.Compression); err != nil {
+		return err
+	}
+	if _, err := releaseParagraph(release, settings.ReleaseFields); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := yaml.NewEncoder(&buf).Encode(settings); err != nil {
+		return err
+	}
+	if err := m.writeFile(metadataPath(dir, MetadataFile), buf.Bytes(), nil); err != nil {
+		return err
+	}
+
+	m.cacheMu.Lock()
+	delete(m.settings, dir)
+	delete(m.signers, dir)
+	delete(m.dirOptions, dir)
+	m.cacheMu.Unlock()
+
+	updated, err := m.suiteSettings(dir)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(current.Compression, updated.Compression) {
+		return m.writeRelease(release)
+	}
+
+	if err := m.recompressIndexes(dir, updated.Compression); err != nil {
+		return err
+	}
+	return m.rebuildRelease(release)
+}
+
+// recompressIndexes rewrites the compressed variants of the Packages and
+// Translation indices of a repository from their uncompressed files.
+func (m *Manager) recompressIndexes(dir string, compression []string) error {
+	var files []string
+	if err := m.storage.Walk(path.Join(DistsDir, dir)+"/", func(found string, err error) error {
+		if err != nil {
+			return err
+		}
+		if name := path.Base(found); name == PackagesFile || name == TranslationFile {
+			files = append(files, found)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, p := range files {
+		data, err := m.storage.ReadFile(p)
+		if err != nil {
+			return err
+		}
+
+		c := compression
+		if c == nil && path.Base(p) == TranslationFile {
+			c = compressions
+		}
+		if err := m.writeIndex(p, data, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
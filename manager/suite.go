@@ -0,0 +1,259 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// aliasFile is the metadata object of a suite alias naming the codename it
+// points to, so resolving the alias doesn't take reading its Release.
+const aliasFile = "alias"
+
+func (m *Manager) PointSuite(suite, codename, previous string) error {
+	for _, name := range []string{suite, previous} {
+		if name != "" && !validName.MatchString(name) {
+			return fmt.Errorf("invalid suite name %q", name)
+		}
+	}
+
+	if !m.repoExists(codename) || m.aliasOf(codename) != "" {
+		return fmt.Errorf("repository %s not found", codename)
+	}
+
+	release, err := m.getRelease(codename)
+	if err != nil {
+		return err
+	}
+	if release.Suite == suite {
+		return nil
+	}
+
+	if m.repoExists(suite) && suite != codename {
+		target := m.aliasOf(suite)
+		if target == "" {
+			return fmt.Errorf("%s is a repository, not a suite alias", suite)
+		}
+
+		if target != codename {
+			old, err := m.getRelease(target)
+			if err != nil {
+				return err
+			}
+			if old.Suite == suite {
+				old.Suite = target
+				if previous != "" {
+					old.Suite = previous
+				}
+				if err := m.writeRelease(old); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	stale := release.Suite
+	release.Suite = suite
+	if err := m.writeRelease(release); err != nil {
+		return err
+	}
+
+	if stale != "" && stale != codename && m.aliasOf(stale) == codename {
+		return m.removeAlias(stale)
+	}
+	return nil
+}
+
+func (m *Manager) removeAlias(alias string) error {
+	m.forgetAlias(alias)
+	for _, prefix := range []string{path.Join(DistsDir, alias) + "/", path.Join(MetadataDir, alias) + "/"} {
+		if _, err := m.storage.RemoveAll(prefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Manager) repoKey(name string) (string, bool) {
+	if !m.repoExists(name) {
+		return name, false
+	}
+	if key := m.aliasOf(name); key != "" {
+		return key, true
+	}
+	return name, true
+}
+
+func (m *Manager) aliasOf(name string) string {
+	m.cacheMu.Lock()
+	target, ok := m.aliases[name]
+	m.cacheMu.Unlock()
+	if ok {
+		return target
+	}
+
+	if target, ok = m.readAlias(name); ok {
+		m.cacheMu.Lock()
+		m.aliases[name] = target
+		m.cacheMu.Unlock()
+	}
+	return target
+}
+
+func (m *Manager) forgetAlias(name string) {
+	m.cacheMu.Lock()
+	defer m.cacheMu.Unlock()
+	delete(m.aliases, name)
+}
+
+// readAlias returns the codename name points to, if any, and whether that
+// could be determined.
+func (m *Manager) readAlias(name string) (string, bool) {
+	p := metadataPath(name, aliasFile)
+	if !m.storage.Exists(p) {
+		return "", true
+	}
+
+	data, err := m.storage.ReadFile(p)
+	if err != nil {
+		return "", false
+	}
+	target := strings.TrimSpace(string(data))
+	if target == name || !m.repoExists(target) {
+		return "", true
+	}
+	return target, true
+}
+
+func (m *Manager) checkAlias(alias, key string) error {
+	if !m.repoExists(alias) {
+		return nil
+	}
+
+	target := m.aliasOf(alias)
+	if target == "" {
+		return fmt.Errorf("%s is a repository, not a suite alias", alias)
+	}
+	if target == key {
+		return nil
+	}
+
+	owner, err := m.getRelease(target)
+	if err != nil {
+		return err
+	}
+	if owner.Suite == alias {
+		return fmt.Errorf("suite %s already points to %s, re-point it with `faptly repo suite`", alias, target)
+	}
+	return nil
+}
+
+// syncAlias copies the files of release that changed since the alias was
+// last synced, together with their by-hash objects, then the Release files,
+// InRelease last. Files the release no longer lists and pruned by-hash
+// objects are removed afterwards. An alias that pointed elsewhere is synced
+// in full.
+func (m *Manager) syncAlias(release *Release) error {
+	key, alias := release.Dir(), release.Suite
+	if err := m.checkAlias(alias, key); err != nil {
+		return err
+	}
+
+	if err := m.writeFile(metadataPath(alias, aliasFile), []byte(key+"\n"), nil); err != nil {
+		return err
+	}
+	m.cacheMu.Lock()
+	m.aliases[alias] = key
+	m.cacheMu.Unlock()
+
+	src := path.Join(DistsDir, key) + "/"
+	dst := path.Join(DistsDir, alias) + "/"
+
+	var (
+		published       map[string]string
+		publishedByHash bool
+	)
+	if m.storage.Exists(dst + PlainReleaseFile) {
+		data, err := m.storage.ReadFile(dst + PlainReleaseFile)
+		if err != nil {
+			return err
+		}
+		old := new(Release)
+		if err := control.Unmarshal(old, bytes.NewReader(data)); err == nil && old.Codename == key {
+			published = make(map[string]string, len(old.SHA256))
+			for _, fh := range old.SHA256 {
+				published[fh.Filename] = fh.Hash
+			}
+			publishedByHash = old.AcquireByHash == "yes"
+		}
+	}
+
+	var (
+		files, byHash []string
+		listed        = make(map[string]bool)
+	)
+	for _, fh := range release.SHA256 {
+		listed[fh.Filename] = true
+		if release.AcquireByHash == "yes" {
+			listed[byHashPath(fh)] = true
+		}
+
+		hash, ok := published[fh.Filename]
+		unchanged := ok && hash == fh.Hash
+		if !unchanged {
+			files = append(files, fh.Filename)
+		}
+		// The by-hash objects of an unchanged file are only there if the
+		// alias already published by-hash.
+		if p := byHashPath(fh); release.AcquireByHash == "yes" && (!unchanged || !publishedByHash || !m.storage.Exists(dst+p)) {
+			byHash = append(byHash, p)
+		}
+	}
+
+	for _, file := range slices.Concat(files, byHash, []string{PlainReleaseFile, ReleaseSignatureFile, ReleaseFile}) {
+		if err := m.copyFile(src+file, dst+file); err != nil {
+			return err
+		}
+	}
+
+	var stale []string
+	if published == nil {
+		if err := m.storage.Walk(dst, func(found string, err error) error {
+			if err != nil {
+				return err
+			}
+			switch file := strings.TrimPrefix(found, dst); file {
+			case PlainReleaseFile, ReleaseSignatureFile, ReleaseFile:
+			default:
+				if !listed[file] {
+					stale = append(stale, file)
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	} else {
+		for file := range published {
+			if !listed[file] {
+				stale = append(stale, file)
+			}
+		}
+		stale = append(stale, release.prunedByHash...)
+	}
+	sort.Strings(stale)
+
+	for _, file := range stale {
+		if !m.storage.Exists(dst + file) {
+			continue
+		}
+		if err := m.storage.Remove(dst + file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestSyncAlias(t *testing.T) {
+	c, _ := testRepo(t, "forky")
+	m := newTestManager(t, c)
+	if err := m.CreateRepo("Test", "stable", "Test", "trixie", "Test", []string{"main"}, []string{"amd64"}, ReleaseOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkSynced := func() *Release {
+		t.Helper()
+		release, err := m.getRelease("trixie")
+		if err != nil {
+			t.Fatal(err)
+		}
+		files := []string{PlainReleaseFile, ReleaseSignatureFile, ReleaseFile}
+		for _, fh := range release.SHA256 {
+			files = append(files, fh.Filename)
+			if release.AcquireByHash == "yes" {
+				files = append(files, byHashPath(fh))
+			}
+		}
+		for _, file := range files {
+			want, err := m.storage.ReadFile(path.Join(DistsDir, "trixie", file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := m.storage.ReadFile(path.Join(DistsDir, "stable", file)); err != nil || !bytes.Equal(got, want) {
+				t.Errorf("stable/%s differs from trixie/%s: %v", file, file, err)
+			}
+		}
+		return release
+	}
+	checkSynced()
+
+	dir := t.TempDir()
+	if err := m.UploadPkgs("stable", "main", []string{writeDeb(t, dir, "hello_1.0_amd64.deb", "Package: hello\nVersion: 1.0\nArchitecture: amd64\n")}); err != nil {
+		t.Fatal(err)
+	}
+	checkSynced()
+
+	// Turning Acquire-By-Hash on changes no index, the alias still needs
+	// their by-hash objects.
+	on := true
+	if err := m.EditRepo("stable", ReleaseOptions{AcquireByHash: &on}, RepoChanges{}); err != nil {
+		t.Fatal(err)
+	}
+	if release := checkSynced(); release.AcquireByHash != "yes" {
+		t.Fatalf("Acquire-By-Hash = %q, want yes", release.AcquireByHash)
+	}
+
+	// A new Manager finds the codename through the pointer object only.
+	m = newTestManager(t, c)
+	if target := m.aliasOf("stable"); target != "trixie" {
+		t.Errorf("aliasOf(stable) = %q, want trixie", target)
+	}
+	if target := m.aliasOf("forky"); target != "" {
+		t.Errorf("aliasOf(forky) = %q, want none", target)
+	}
+	if err := m.UploadPkgs("stable", "main", []string{writeDeb(t, dir, "hello_1.1_amd64.deb", "Package: hello\nVersion: 1.1\nArchitecture: amd64\n")}); err != nil {
+		t.Fatal(err)
+	}
+	checkSynced()
+
+	for _, name := range []string{"stable", "trixie"} {
+		release, err := m.ShowRepo(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if release.Dir() != "trixie" || release.Suite != "stable" {
+			t.Errorf("ShowRepo(%s) = %s, suite %s, want trixie, suite stable", name, release.Dir(), release.Suite)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package manager
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"github.com/akozlenkov/go-debian/control"
+	"slices"
+	"strings"
+)
+
+type Translation struct {
+	control.Paragraph
+
+	Package        string
+	DescriptionMD5 string `control:"Description-md5"`
+	DescriptionEn  string `control:"Description-en"`
+}
+
+func descriptionMD5(description string) string {
+	lines := strings.Split(description, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] == "" {
+			lines[i] = "."
+		}
+		lines[i] = " " + lines[i]
+	}
+	return fmt.Sprintf("%x", md5.Sum([]byte(strings.Join(lines, "\n")+"\n")))
+}
+
+func parseTranslations(data []byte) (map[string]string, error) {
+	var translations []Translation
+	if err := control.Unmarshal(&translations, bufio.NewReader(bytes.NewReader(data))); err != nil {
+		return nil, err
+	}
+
+	descriptions := make(map[string]string, len(translations))
+	for _, t := range translations {
+		descriptions[t.DescriptionMD5] = strings.TrimRight(t.DescriptionEn, "\n")
+	}
+	return descriptions, nil
+}
+
+func restoreDescriptions(indexes []control.BinaryIndex, descriptions map[string]string) {
+	for i, index := range indexes {
+		if description, ok := descriptions[index.DescriptionMD5]; ok {
+			indexes[i].Description = description
+		}
+	}
+}
+
+func splitDescriptions(indexes map[string][]control.BinaryIndex, split bool) (map[string][]control.BinaryIndex, []Translation) {
+	var (
+		translations []Translation
+		seen         = make(map[string]bool)
+		ret          = make(map[string][]control.BinaryIndex, len(indexes))
+	)
+
+	for arch, index := range indexes {
+		ret[arch] = make([]control.BinaryIndex, len(index))
+		for i, idx := range index {
+			idx.Description = strings.TrimRight(idx.Description, "\n")
+
+			if !split {
+				idx.DescriptionMD5 = ""
+				idx.Paragraph = withoutField(idx.Paragraph, "Description-md5")
+				ret[arch][i] = idx
+				continue
+			}
+
+			idx.DescriptionMD5 = descriptionMD5(idx.Description)
+			if key := idx.Package + " " + idx.DescriptionMD5; !seen[key] {
+				seen[key] = true
+				translations = append(translations, Translation{
+					Package:        idx.Package,
+					DescriptionMD5: idx.DescriptionMD5,
+					DescriptionEn:  idx.Description,
+				})
+			}
+			idx.Description, _, _ = strings.Cut(idx.Description, "\n")
+			ret[arch][i] = idx
+		}
+	}
+
+	slices.SortFunc(translations, func(a, b Translation) int {
+		if c := strings.Compare(a.Package, b.Package); c != 0 {
+			return c
+		}
+		return strings.Compare(a.DescriptionMD5, b.DescriptionMD5)
+	})
+
+	return ret, translations
+}
+
+func withoutField(p control.Paragraph, key string) control.Paragraph {
+	ret := control.Paragraph{Values: make(map[string]string, len(p.Values))}
+	for _, k := range p.Order {
+		if k != key {
+			ret.Order = append(ret.Order, k)
+			ret.Values[k] = p.Values[k]
+		}
+	}
+	return ret
+}
@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+const helloControl = `Package: hello
+Version: 1.0
+Architecture: amd64
+Description: Greeting program
+ Prints a greeting.
+ .
+ Second paragraph.
+`
+
+func TestDescriptionMD5(t *testing.T) {
+	// The md5sum of the Description field as it appears in the control file.
+	description := strings.TrimRight(readControl(t, helloControl).Description, "\n")
+	if sum := descriptionMD5(description); sum != "bc7d3f7d740de6d1bc7d1447075d7095" {
+		t.Errorf("descriptionMD5(%q) = %s", description, sum)
+	}
+}
+
+func TestUploadSplitDescriptions(t *testing.T) {
+	for _, split := range []bool{false, true} {
+		t.Run(map[bool]string{false: "inline", true: "split"}[split], func(t *testing.T) {
+			c, _ := testRepo(t, "trixie")
+			c.SplitDescriptions = split
+			m := newTestManager(t, c)
+			dir := t.TempDir()
+
+			if err := m.UploadPkgs("trixie", "main", []string{writeDeb(t, dir, "hello_1.0_amd64.deb", helloControl)}); err != nil {
+				t.Fatal(err)
+			}
+			// Uploading another package must keep the split description.
+			if err := m.UploadPkgs("trixie", "main", []string{
+				writeDeb(t, dir, "bye_1.0_amd64.deb", "Package: bye\nVersion: 1.0\nArchitecture: amd64\nDescription: Farewell\n"),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			packages, err := m.storage.ReadFile(path.Join(DistsDir, "trixie", "main", "binary-amd64", PackagesFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			translationPath := path.Join(DistsDir, "trixie", "main", I18nDir, TranslationFile)
+
+			if !split {
+				if !strings.Contains(string(packages), "Description: Greeting program\n Prints a greeting.\n .\n Second paragraph.\n") || strings.Contains(string(packages), "Description-md5") {
+					t.Errorf("Packages =\n%s\nwant the full description only", packages)
+				}
+				if m.storage.Exists(translationPath) {
+					t.Errorf("%s exists", translationPath)
+				}
+				return
+			}
+
+			if !strings.Contains(string(packages), "Description: Greeting program\n") || strings.Contains(string(packages), "Prints a greeting") ||
+				!strings.Contains(string(packages), "Description-md5: bc7d3f7d740de6d1bc7d1447075d7095\n") {
+				t.Errorf("Packages =\n%s\nwant the short description and its md5", packages)
+			}
+			translations, err := m.storage.ReadFile(translationPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := "Package: hello\nDescription-md5: bc7d3f7d740de6d1bc7d1447075d7095\nDescription-en: Greeting program\n Prints a greeting.\n .\n Second paragraph.\n"
+			if !strings.Contains(string(translations), want) || !strings.Contains(string(translations), "Package: bye\n") {
+				t.Errorf("%s =\n%s\nwant both packages, hello as\n%s", TranslationFile, translations, want)
+			}
+
+			idx, err := m.ShowPkg("trixie", "main", "amd64", "hello_1.0_amd64.deb")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idx.Description != "Greeting program\nPrints a greeting.\n\nSecond paragraph." {
+				t.Errorf("ShowPkg() Description = %q, want the full description", idx.Description)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package pgp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ModeClearsign = "clearsign"
+	ModeDetach    = "detach"
+)
+
+var armorHeaders = map[string]string{
+	ModeClearsign: "-----BEGIN PGP SIGNED MESSAGE-----",
+	ModeDetach:    "-----BEGIN PGP SIGNATURE-----",
+}
+
+// checkArmor catches external signers that exit successfully without
+// producing the requested signature.
+func checkArmor(signature []byte, mode string) ([]byte, error) {
+	if !bytes.HasPrefix(bytes.TrimSpace(signature), []byte(armorHeaders[mode])) {
+		return nil, fmt.Errorf("%s signature is missing or not armored", mode)
+	}
+	return signature, nil
+}
+
+// signParams lists the requested signature settings as key=value pairs.
+func signParams(opts SignOptions) []string {
+	var params []string
+	if name := opts.hashName(); name != "" {
+		params = append(params, "hash="+name)
+	}
+	if opts.Time != nil {
+		params = append(params, "time="+strconv.FormatInt(opts.Now().Unix(), 10))
+	}
+	return params
+}
+
+// CommandSigner signs by running an external command once per signature.
+// The command reads the data to sign on stdin, finds the kind of signature
+// requested (clearsign or detach) in FAPTLY_SIGN_MODE and writes the armored
+// result to stdout. Signature settings, when configured, are passed in
+// FAPTLY_SIGN_HASH and FAPTLY_SIGN_TIME (Unix time).
+// The command can't be asked for its public keys, so they are configured
+// alongside it in PublicKey.
+type CommandSigner struct {
+	Command   []string
+	PublicKey []byte
+	Options   SignOptions
+}
+
+func NewCommandSigner(command []string, publicKey []byte, opts SignOptions) *CommandSigner {
+	return &CommandSigner{Command: command, PublicKey: publicKey, Options: opts}
+}
+
+func (s *CommandSigner) PublicKeys() ([]byte, error) {
+	if len(s.PublicKey) == 0 {
+		return nil, errors.New("no public key configured for the signing command")
+	}
+	return dearmorKeyring(s.PublicKey)
+}
+
+func (s *CommandSigner) Sign(data []byte) ([]byte, []byte, error) {
+	if len(s.Command) == 0 {
+		return nil, nil, errors.New("no signing command configured")
+	}
+
+	clearsigned, err := s.run(data, ModeClearsign)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detached, err := s.run(data, ModeDetach)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clearsigned, detached, nil
+}
+
+func (s *CommandSigner) run(data []byte, mode string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), "FAPTLY_SIGN_MODE="+mode)
+	for _, param := range signParams(s.Options) {
+		key, value, _ := strings.Cut(param, "=")
+		cmd.Env = append(cmd.Env, "FAPTLY_SIGN_"+strings.ToUpper(key)+"="+value)
+	}
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("signing command %s (%s): %w: %s", s.Command[0], mode, err, strings.TrimSpace(stderr.String()))
+	}
+	return checkArmor(stdout.Bytes(), mode)
+}
+
+// SocketSigner signs by talking to a signing service on a Unix socket, one
+// request per connection. The request is a "<mode> <length> [key=value...]"
+// line followed by length bytes of data, where the optional pairs carry the
+// hash and time settings; the service answers with "OK <length>" followed by
+// the signature, or with "ERR <message>". As with CommandSigner, the public
+// keys are configured in PublicKey.
+type SocketSigner struct {
+	Path      string
+	PublicKey []byte
+	Timeout   time.Duration
+	Options   SignOptions
+}
+
+func NewSocketSigner(path string, publicKey []byte, opts SignOptions) *SocketSigner {
+	return &SocketSigner{Path: path, PublicKey: publicKey, Timeout: time.Minute, Options: opts}
+}
+
+func (s *SocketSigner) PublicKeys() ([]byte, error) {
+	if len(s.PublicKey) == 0 {
+		return nil, fmt.Errorf("no public key configured for the signing socket %s", s.Path)
+	}
+	return dearmorKeyring(s.PublicKey)
+}
+
+func (s *SocketSigner) Sign(data []byte) ([]byte, []byte, error) {
+	clearsigned, err := s.request(data, ModeClearsign)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detached, err := s.request(data, ModeDetach)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clearsigned, detached, nil
+}
+
+func (s *SocketSigner) request(data []byte, mode string) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", s.Path, s.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if s.Timeout > 0 {
+		if err := conn.SetDeadline(time.Now().Add(s.Timeout)); err != nil {
+			return nil, err
+		}
+	}
+
+	request := append([]string{mode, strconv.Itoa(len(data))}, signParams(s.Options)...)
+	if _, err := fmt.Fprintln(conn, strings.Join(request, " ")); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("signing socket %s: %w", s.Path, err)
+	}
+
+	status, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+	switch status {
+	case "OK":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("signing socket %s: malformed response %q", s.Path, strings.TrimSpace(line))
+		}
+		signature := make([]byte, n)
+		if _, err := io.ReadFull(r, signature); err != nil {
+			return nil, fmt.Errorf("signing socket %s: %w", s.Path, err)
+		}
+		return checkArmor(signature, mode)
+	case "ERR":
+		return nil, fmt.Errorf("signing socket %s: %s", s.Path, arg)
+	default:
+		return nil, fmt.Errorf("signing socket %s: malformed response %q", s.Path, strings.TrimSpace(line))
+	}
+}
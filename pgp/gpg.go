@@ -0,0 +1,71 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// GPGSigner signs by running gpg, leaving the private keys and their
+// passphrases to gpg-agent.
+type GPGSigner struct {
+	Binary  string
+	Homedir string
+	KeyIDs  []string
+	Options SignOptions
+}
+
+func NewGPGSigner(binary, homedir string, keyIDs []string, opts SignOptions) *GPGSigner {
+	if binary == "" {
+		binary = "gpg"
+	}
+	return &GPGSigner{Binary: binary, Homedir: homedir, KeyIDs: keyIDs, Options: opts}
+}
+
+func (s *GPGSigner) Sign(data []byte) ([]byte, []byte, error) {
+	clearsigned, err := s.run(data, ModeClearsign)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detached, err := s.run(data, ModeDetach)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clearsigned, detached, nil
+}
+
+func (s *GPGSigner) run(data []byte, mode string) ([]byte, error) {
+	args := []string{"--batch", "--yes", "--armor"}
+	if s.Homedir != "" {
+		args = append(args, "--homedir", s.Homedir)
+	}
+	if name := s.Options.hashName(); name != "" {
+		args = append(args, "--digest-algo", name)
+	}
+	if s.Options.Time != nil {
+		args = append(args, "--faked-system-time", strconv.FormatInt(s.Options.Now().Unix(), 10)+"!")
+	}
+	for _, id := range s.KeyIDs {
+		args = append(args, "--local-user", id)
+	}
+	if mode == ModeClearsign {
+		args = append(args, "--clearsign")
+	} else {
+		args = append(args, "--detach-sign")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.Binary, args...)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s (%s): %w: %s", s.Binary, mode, err, strings.TrimSpace(stderr.String()))
+	}
+	return checkArmor(stdout.Bytes(), mode)
+}
@@ -0,0 +1,164 @@
+package pgp
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const (
+	KeyTypeEd25519 = "ed25519"
+	KeyTypeRSA4096 = "rsa4096"
+)
+
+// PublicKeyExporter is implemented by signers that can hand out the public
+// keys their signatures verify with.
+type PublicKeyExporter interface {
+	PublicKeys() ([]byte, error)
+}
+
+// GenerateKey creates a signing key and returns it armored, encrypted with
+// passphrase unless it is empty, along with its fingerprint. A zero expiry
+// creates a key that never expires.
+func GenerateKey(name, email, keyType string, expiry time.Duration, passphrase []byte) ([]byte, string, error) {
+	config := &packet.Config{
+		DefaultHash:     crypto.SHA512,
+		KeyLifetimeSecs: uint32(expiry.Seconds()),
+	}
+	switch keyType {
+	case KeyTypeEd25519:
+		config.Algorithm = packet.PubKeyAlgoEdDSA
+		config.Curve = packet.Curve25519
+	case KeyTypeRSA4096:
+		config.Algorithm = packet.PubKeyAlgoRSA
+		config.RSABits = 4096
+	default:
+		return nil, "", fmt.Errorf("unsupported key type %s", keyType)
+	}
+
+	entity, err := openpgp.NewEntity(name, "", email, config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if len(passphrase) != 0 {
+		if err := entity.EncryptPrivateKeys(passphrase, nil); err != nil {
+			return nil, "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := entity.SerializePrivateWithoutSigning(w, nil); err != nil {
+		return nil, "", err
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint), nil
+}
+
+// ArmorPublicKeys armors a binary public keyring.
+func ArmorPublicKeys(keyring []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(keyring); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// dearmorKeyring returns an armored or binary public keyring in binary form.
+func dearmorKeyring(data []byte) ([]byte, error) {
+	keyring, err := ReadKeyring(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyring.entities) == 0 {
+		return nil, errors.New("no public keys found")
+	}
+
+	var buf bytes.Buffer
+	for _, entity := range keyring.entities {
+		if err := entity.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// PublicKeys returns the binary public keyring of the keys, each certificate
+// serialized once even when several keys select subkeys of it.
+func (s *KeySigner) PublicKeys() ([]byte, error) {
+	if len(s.Keys) == 0 {
+		return nil, errors.New("no signing keys configured")
+	}
+
+	var (
+		buf  bytes.Buffer
+		seen = make(map[string]bool)
+	)
+	for _, k := range s.Keys {
+		entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k.PrivateKey))
+		if err != nil {
+			return nil, err
+		}
+		entity, _, err := findEntity(entityList, k.KeyID)
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+
+		if err := entity.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *GPGSigner) PublicKeys() ([]byte, error) {
+	args := []string{"--batch", "--export"}
+	if s.Homedir != "" {
+		args = append([]string{"--homedir", s.Homedir}, args...)
+	}
+	for _, id := range s.KeyIDs {
+		args = append(args, strings.TrimSuffix(id, "!"))
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(s.Binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s --export: %w: %s", s.Binary, err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, fmt.Errorf("%s --export: no public keys found", s.Binary)
+	}
+	return stdout.Bytes(), nil
+}
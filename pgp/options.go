@@ -0,0 +1,97 @@
+package pgp
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+var hashes = map[string]crypto.Hash{
+	"SHA224":   crypto.SHA224,
+	"SHA256":   crypto.SHA256,
+	"SHA384":   crypto.SHA384,
+	"SHA512":   crypto.SHA512,
+	"SHA3-256": crypto.SHA3_256,
+	"SHA3-512": crypto.SHA3_512,
+}
+
+// SignOptions control the signatures made by every Signer. A zero Hash
+// leaves the digest to the signer, a nil Time signs with the current time.
+type SignOptions struct {
+	Hash crypto.Hash
+	Time func() time.Time
+}
+
+func (o SignOptions) Now() time.Time {
+	if o.Time == nil {
+		return time.Now()
+	}
+	return o.Time()
+}
+
+func (o SignOptions) packetConfig() *packet.Config {
+	c := &packet.Config{
+		DefaultHash: o.Hash,
+		Time:        o.Time,
+	}
+	if o.Time != nil {
+		// A pinned clock asks for reproducible signatures, so drop the
+		// random salt notation; RSA and EdDSA signatures are deterministic.
+		randomize := false
+		c.NonDeterministicSignaturesViaNotation = &randomize
+	}
+	return c
+}
+
+func (o SignOptions) hashName() string {
+	for name, h := range hashes {
+		if h == o.Hash {
+			return name
+		}
+	}
+	return ""
+}
+
+// ParseHash parses a digest algorithm name such as SHA512.
+func ParseHash(name string) (crypto.Hash, error) {
+	if name == "" {
+		return 0, nil
+	}
+	h, ok := hashes[strings.ToUpper(name)]
+	if !ok {
+		return 0, fmt.Errorf("unsupported hash algorithm %s", name)
+	}
+	return h, nil
+}
+
+// ParseTime parses the signing time source: empty or "now" for the current
+// time, "source_date_epoch" for the SOURCE_DATE_EPOCH environment variable, or
+// a fixed RFC 3339 timestamp.
+func ParseTime(source string) (func() time.Time, error) {
+	switch source {
+	case "", "now":
+		return nil, nil
+	case "source_date_epoch":
+		v := os.Getenv("SOURCE_DATE_EPOCH")
+		if v == "" {
+			return nil, fmt.Errorf("SOURCE_DATE_EPOCH is not set")
+		}
+		epoch, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH %s", v)
+		}
+		t := time.Unix(epoch, 0).UTC()
+		return func() time.Time { return t }, nil
+	default:
+		t, err := time.Parse(time.RFC3339, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing time %s: %w", source, err)
+		}
+		return func() time.Time { return t }, nil
+	}
+}
@@ -3,46 +3,187 @@ package pgp
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
-func decodePrivateEntity(privateKey []byte, passphrase []byte) (*openpgp.Entity, error) {
-	entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(privateKey))
-	if err != nil {
-		return nil, err
+// findEntity returns the entity whose primary key or subkey matches keyID
+// (a fingerprint or a long/short key ID) together with the ID of the matched
+// subkey, or 0 when the primary key matched. An empty keyID selects the first
+// entity of the keyring.
+func findEntity(entities openpgp.EntityList, keyID string) (*openpgp.Entity, uint64, error) {
+	if len(entities) == 0 {
+		return nil, 0, errors.New("no keys found")
 	}
-	if len(entityList) == 0 {
-		return nil, errors.New("no keys found")
+	if keyID == "" {
+		return entities[0], 0, nil
 	}
 
-	entity := entityList[0]
-	if entity.PrivateKey.Encrypted {
-		if err := entity.PrivateKey.Decrypt(passphrase); err != nil {
-			return nil, err
+	id := strings.ToUpper(strings.TrimPrefix(strings.ReplaceAll(keyID, " ", ""), "0x"))
+	for _, entity := range entities {
+		if matchKey(entity.PrimaryKey, id) {
+			return entity, 0, nil
 		}
-	}
-	for _, sub := range entity.Subkeys {
-		if sub.PrivateKey != nil && sub.PrivateKey.Encrypted {
-			if err := sub.PrivateKey.Decrypt(passphrase); err != nil {
-				return nil, err
+		for _, sub := range entity.Subkeys {
+			if matchKey(sub.PublicKey, id) {
+				return entity, sub.PublicKey.KeyId, nil
 			}
 		}
 	}
+	return nil, 0, fmt.Errorf("key %s not found", keyID)
+}
+
+// HasKey reports whether the armored keyring holds a key or subkey matching
+// keyID.
+func HasKey(keyring []byte, keyID string) bool {
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keyring))
+	if err != nil || keyID == "" {
+		return false
+	}
+	_, _, err = findEntity(entities, keyID)
+	return err == nil
+}
 
-	return entity, nil
+func matchKey(key *packet.PublicKey, id string) bool {
+	return fmt.Sprintf("%X", key.Fingerprint) == id ||
+		key.KeyIdString() == id ||
+		key.KeyIdShortString() == id
 }
 
-func SignData(privateKey []byte, passphrase []byte, data []byte) ([]byte, error) {
-	signed := &bytes.Buffer{}
+func signingKey(entity *openpgp.Entity, subkeyID uint64, passphrase []byte, now time.Time) (*packet.PrivateKey, error) {
+	fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+
+	if now.Before(entity.PrimaryKey.CreationTime) {
+		return nil, fmt.Errorf("key %s is not valid before %s", fingerprint, entity.PrimaryKey.CreationTime.UTC().Format(time.RFC3339))
+	}
+	if entity.Revoked(now) {
+		return nil, fmt.Errorf("key %s is revoked", fingerprint)
+	}
+	if sig, _ := entity.PrimarySelfSignature(); sig != nil && (entity.PrimaryKey.KeyExpired(sig, now) || sig.SigExpired(now)) {
+		return nil, fmt.Errorf("key %s is expired", fingerprint)
+	}
+
+	key, ok := entity.SigningKeyById(now, subkeyID)
+	if !ok {
+		if subkeyID != 0 {
+			return nil, fmt.Errorf("subkey %X of key %s can't sign: it is expired, revoked or not signing-capable", subkeyID, fingerprint)
+		}
+		return nil, fmt.Errorf("key %s has no valid signing key", fingerprint)
+	}
+	if key.PrivateKey == nil || key.PrivateKey.Dummy() {
+		return nil, fmt.Errorf("secret part of signing key %X is not available", key.PublicKey.Fingerprint)
+	}
+
+	if key.PrivateKey.Encrypted {
+		if err := key.PrivateKey.Decrypt(passphrase); err != nil {
+			return nil, fmt.Errorf("decrypt signing key %X: %w", key.PublicKey.Fingerprint, err)
+		}
+	}
+	return key.PrivateKey, nil
+}
+
+// Key is an armored private keyring together with the passphrase protecting
+// it and the fingerprint or key ID selecting the key to sign with.
+type Key struct {
+	PrivateKey []byte
+	Passphrase []byte
+	KeyID      string
+}
+
+type privateKey struct {
+	entity *openpgp.Entity
+	key    *packet.PrivateKey
+}
 
-	entity, err := decodePrivateEntity(privateKey, passphrase)
+func decodePrivateKey(k Key, now time.Time) (privateKey, error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(k.PrivateKey))
 	if err != nil {
-		return nil, err
+		return privateKey{}, err
+	}
+
+	entity, subkeyID, err := findEntity(entityList, k.KeyID)
+	if err != nil {
+		return privateKey{}, err
+	}
+
+	key, err := signingKey(entity, subkeyID, k.Passphrase, now)
+	if err != nil {
+		return privateKey{}, err
+	}
+	return privateKey{entity: entity, key: key}, nil
+}
+
+// CheckKey decrypts the key selected by k and makes sure it can sign now.
+func CheckKey(k Key) error {
+	_, err := decodePrivateKey(k, time.Now())
+	return err
+}
+
+// Signer produces the signatures of a Release file: the clearsigned
+// InRelease and the armored detached Release.gpg.
+type Signer interface {
+	Sign(data []byte) (clearsigned []byte, detached []byte, err error)
+}
+
+// KeySigner signs in-process with private keys held in memory.
+type KeySigner struct {
+	Keys    []Key
+	Options SignOptions
+}
+
+func NewKeySigner(keys []Key, opts SignOptions) *KeySigner {
+	return &KeySigner{Keys: keys, Options: opts}
+}
+
+func (s *KeySigner) Sign(data []byte) ([]byte, []byte, error) {
+	if len(s.Keys) == 0 {
+		return nil, nil, errors.New("no signing keys configured")
+	}
+
+	now := s.Options.Now()
+	privateKeys := make([]privateKey, len(s.Keys))
+	for i, k := range s.Keys {
+		pk, err := decodePrivateKey(k, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateKeys[i] = pk
+	}
+
+	clearsigned, err := clearSign(privateKeys, data, s.Options.packetConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	detached, err := detachSign(privateKeys, data, s.Options.packetConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clearsigned, detached, nil
+}
+
+// SignData signs data with every key and returns it clearsigned (InRelease)
+// along with an armored detached signature (Release.gpg).
+func SignData(keys []Key, data []byte) ([]byte, []byte, error) {
+	return NewKeySigner(keys, SignOptions{}).Sign(data)
+}
+
+func clearSign(keys []privateKey, data []byte, config *packet.Config) ([]byte, error) {
+	signed := &bytes.Buffer{}
+
+	privateKeys := make([]*packet.PrivateKey, len(keys))
+	for i, k := range keys {
+		privateKeys[i] = k.key
 	}
 
-	encoder, err := clearsign.Encode(signed, entity.PrivateKey, nil)
+	encoder, err := clearsign.EncodeMulti(signed, privateKeys, config)
 	if err != nil {
 		return nil, err
 	}
@@ -57,3 +198,27 @@ func SignData(privateKey []byte, passphrase []byte, data []byte) ([]byte, error)
 
 	return signed.Bytes(), nil
 }
+
+func detachSign(keys []privateKey, data []byte, config *packet.Config) ([]byte, error) {
+	signed := &bytes.Buffer{}
+
+	w, err := armor.Encode(signed, "PGP SIGNATURE", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		c := *config
+		c.SigningKeyId = k.key.KeyId
+		if err := openpgp.DetachSign(w, k.entity, bytes.NewReader(data), &c); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	signed.WriteString("\n")
+
+	return signed.Bytes(), nil
+}
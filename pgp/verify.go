@@ -0,0 +1,107 @@
+package pgp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Signature describes a verified signature.
+type Signature struct {
+	Fingerprint string
+	Date        time.Time
+}
+
+// Keyring holds the public keys signatures are verified against.
+type Keyring struct {
+	entities openpgp.EntityList
+}
+
+// ReadKeyring reads armored or binary public keyrings.
+func ReadKeyring(keyrings ...[]byte) (*Keyring, error) {
+	k := &Keyring{}
+	for _, data := range keyrings {
+		if len(data) == 0 {
+			continue
+		}
+
+		var (
+			entities openpgp.EntityList
+			err      error
+		)
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+			entities, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+		} else {
+			entities, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+		}
+		if err != nil {
+			return nil, err
+		}
+		k.entities = append(k.entities, entities...)
+	}
+	return k, nil
+}
+
+// Verify checks a clearsigned message and returns its text along with every
+// signature made by a key of the keyring. Signatures by unknown keys are
+// skipped, but at least one signature must verify and none of the known
+// keys may have a bad one.
+func (k *Keyring) Verify(data []byte) ([]byte, []Signature, error) {
+	block, _ := clearsign.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("not a clearsigned message")
+	}
+	if len(k.entities) == 0 {
+		return block.Plaintext, nil, errors.New("no public keys to verify the signature with")
+	}
+
+	var signatures []Signature
+	packets := packet.NewReader(block.ArmoredSignature.Body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return block.Plaintext, nil, err
+		}
+
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			return block.Plaintext, nil, errors.New("non signature packet found")
+		}
+
+		var buf bytes.Buffer
+		if err := sig.Serialize(&buf); err != nil {
+			return block.Plaintext, nil, err
+		}
+
+		verified, signer, err := openpgp.VerifyDetachedSignature(k.entities, bytes.NewReader(block.Bytes), &buf, nil)
+		if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+			continue
+		}
+		if err != nil {
+			if sig.IssuerKeyId == nil {
+				return block.Plaintext, nil, fmt.Errorf("bad signature: %w", err)
+			}
+			return block.Plaintext, nil, fmt.Errorf("bad signature by key %X: %w", *sig.IssuerKeyId, err)
+		}
+
+		signatures = append(signatures, Signature{
+			Fingerprint: fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint),
+			Date:        verified.CreationTime,
+		})
+	}
+
+	if len(signatures) == 0 {
+		return block.Plaintext, nil, errors.New("no signature by a known key")
+	}
+	return block.Plaintext, signatures, nil
+}
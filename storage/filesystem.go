@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type FilesystemStorage struct {
+	root string
+}
+
+func NewFilesystem(root string) (*FilesystemStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FilesystemStorage{root: root}, nil
+}
+
+// path maps an object name to a file under root, refusing names such as
+// ../x that resolve outside of it.
+func (fss *FilesystemStorage) path(name string) (string, error) {
+	p := filepath.Join(fss.root, filepath.FromSlash(name))
+	rel, err := filepath.Rel(fss.root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of %s", name, fss.root)
+	}
+	return p, nil
+}
+
+func (fss *FilesystemStorage) Exists(path string) bool {
+	p, err := fss.path(path)
+	if err != nil {
+		return false
+	}
+	if _, err := os.Stat(p); err != nil {
+		return false
+	}
+	return true
+}
+
+func (fss *FilesystemStorage) ReadFile(path string) ([]byte, error) {
+	p, err := fss.path(path)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (fss *FilesystemStorage) WriteFile(path string, data []byte, opts ObjectOptions) error {
+	target, err := fss.path(path)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (fss *FilesystemStorage) WriteFileWithReader(path string, data []byte, opts ObjectOptions, progress io.Reader) error {
+	if err := fss.WriteFile(path, data, opts); err != nil {
+		return err
+	}
+	if progress != nil {
+		if _, err := io.CopyN(ioutil.Discard, progress, int64(len(data))); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fss *FilesystemStorage) Copy(src, dst string, opts ObjectOptions) error {
+	source, err := fss.path(src)
+	if err != nil {
+		return err
+	}
+	target, err := fss.path(dst)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Link(source, target); err == nil {
+		return nil
+	}
+
+	data, err := fss.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return fss.WriteFile(dst, data, ObjectOptions{})
+}
+
+func (fss *FilesystemStorage) Remove(name string) error {
+	p, err := fss.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (fss *FilesystemStorage) RemoveAll(path string) (int, error) {
+	dir, err := fss.path(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		removed int
+		errs    []error
+	)
+
+	if err := fss.Walk(path, func(found string, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(fss.root, filepath.FromSlash(found))); err != nil {
+			errs = append(errs, fmt.Errorf("remove %s: %w", found, err))
+			return nil
+		}
+		removed++
+		return nil
+	}); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) == 0 {
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return removed, errors.Join(errs...)
+}
+
+func (fss *FilesystemStorage) Walk(root string, fn func(path string, err error) error) error {
+	dir, err := fss.path(root)
+	if err != nil {
+		return err
+	}
+
+	err = filepath.WalkDir(dir, func(found string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(found, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fss.root, found)
+		if err != nil {
+			return err
+		}
+		return fn(filepath.ToSlash(rel), nil)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilesystemStaysUnderRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+
+	fss, err := NewFilesystem(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outside"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"../outside", "dists/../../outside", "pool/../../root2/x"} {
+		t.Run(name, func(t *testing.T) {
+			if fss.Exists(name) {
+				t.Errorf("Exists(%q) = true", name)
+			}
+			if _, err := fss.ReadFile(name); err == nil {
+				t.Errorf("ReadFile(%q) succeeded", name)
+			}
+			if err := fss.WriteFile(name, []byte("x"), ObjectOptions{}); err == nil {
+				t.Errorf("WriteFile(%q) succeeded", name)
+			}
+			if err := fss.Remove(name); err == nil {
+				t.Errorf("Remove(%q) succeeded", name)
+			}
+			if _, err := fss.RemoveAll(name + "/"); err == nil {
+				t.Errorf("RemoveAll(%q) succeeded", name)
+			}
+		})
+	}
+
+	if data, err := os.ReadFile(filepath.Join(dir, "outside")); err != nil || string(data) != "secret" {
+		t.Errorf("file outside of root = %q, %v", data, err)
+	}
+
+	// Names that only pass through a parent stay usable.
+	if err := fss.WriteFile("dists/../pool/a", []byte("a"), ObjectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fss.Copy("pool/a", "pool/b", ObjectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fss.ReadFile("pool/b"); err != nil || string(data) != "a" {
+		t.Errorf("ReadFile(pool/b) = %q, %v", data, err)
+	}
+}
@@ -3,85 +3,203 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"io"
 	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
 )
 
+const maxCopyObjectSize = 5 << 30
+
 type MinioStorage struct {
 	bucket  string
+	prefix  string
 	client  *minio.Client
 	context context.Context
 }
 
-func New(endpoint, bucket, accessKey, secretKey string) (*MinioStorage, error) {
-	client, err := minio.New(endpoint, &minio.Options{
+// ParseEndpoint accepts either a bare host[:port], served over HTTPS, or an
+// http:// or https:// URL without a path.
+func ParseEndpoint(endpoint string) (string, bool, error) {
+	if !strings.Contains(endpoint, "://") {
+		if endpoint == "" || strings.ContainsAny(endpoint, "/?#") {
+			return "", false, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		return endpoint, true, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid S3 endpoint %q: %w", endpoint, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false, fmt.Errorf("invalid S3 endpoint %q: scheme must be http or https", endpoint)
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		return "", false, fmt.Errorf("invalid S3 endpoint %q: expected scheme://host[:port]", endpoint)
+	}
+	return u.Host, u.Scheme == "https", nil
+}
+
+func New(endpoint, bucket, prefix, accessKey, secretKey string) (*MinioStorage, error) {
+	host, secure, err := ParseEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := minio.New(host, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: true,
+		Secure: secure,
 	})
 	if err != nil {
 		return nil, err
 	}
-	return &MinioStorage{bucket: bucket, client: client, context: context.Background()}, nil
+	return &MinioStorage{
+		bucket:  bucket,
+		prefix:  strings.Trim(prefix, "/"),
+		client:  client,
+		context: context.Background(),
+	}, nil
+}
+
+func (ms *MinioStorage) key(name string) string {
+	if ms.prefix == "" {
+		return name
+	}
+	if strings.HasSuffix(name, "/") {
+		return path.Join(ms.prefix, name) + "/"
+	}
+	return path.Join(ms.prefix, name)
+}
+
+func (ms *MinioStorage) name(key string) string {
+	if ms.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, ms.prefix+"/")
 }
 
 func (ms *MinioStorage) Exists(path string) bool {
-	if _, err := ms.client.StatObject(ms.context, ms.bucket, path, minio.StatObjectOptions{}); err != nil {
+	if _, err := ms.client.StatObject(ms.context, ms.bucket, ms.key(path), minio.StatObjectOptions{}); err != nil {
 		return false
 	}
 	return true
 }
 
 func (ms *MinioStorage) ReadFile(path string) ([]byte, error) {
-	object, err := ms.client.GetObject(ms.context, ms.bucket, path, minio.GetObjectOptions{})
+	object, err := ms.client.GetObject(ms.context, ms.bucket, ms.key(path), minio.GetObjectOptions{})
 	if err != nil {
 		return nil, err
 	}
 	return ioutil.ReadAll(object)
 }
 
-func (ms *MinioStorage) WriteFile(path string, data []byte) error {
+func (ms *MinioStorage) WriteFile(path string, data []byte, opts ObjectOptions) error {
+	return ms.WriteFileWithReader(path, data, opts, nil)
+}
+
+func (ms *MinioStorage) WriteFileWithReader(path string, data []byte, opts ObjectOptions, progress io.Reader) error {
 	reader := bytes.NewReader(data)
-	if _, err := ms.client.PutObject(ms.context, ms.bucket, path, reader, reader.Size(), minio.PutObjectOptions{}); err != nil {
+	if _, err := ms.client.PutObject(ms.context, ms.bucket, ms.key(path), reader, reader.Size(), minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		CacheControl: opts.CacheControl,
+		UserMetadata: opts.Metadata,
+		Progress:     progress,
+	}); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (ms *MinioStorage) WriteFileWithReader(path string, data []byte, progress io.Reader) error {
-	reader := bytes.NewReader(data)
-	if _, err := ms.client.PutObject(ms.context, ms.bucket, path, reader, reader.Size(), minio.PutObjectOptions{Progress: progress}); err != nil {
+// Copy copies src to dst server-side, giving dst the metadata of opts rather
+// than that of src.
+func (ms *MinioStorage) Copy(src, dst string, opts ObjectOptions) error {
+	info, err := ms.client.StatObject(ms.context, ms.bucket, ms.key(src), minio.StatObjectOptions{})
+	if err != nil {
 		return err
 	}
-	return nil
+
+	srcOpts := minio.CopySrcOptions{Bucket: ms.bucket, Object: ms.key(src)}
+	dstOpts := minio.CopyDestOptions{
+		Bucket:          ms.bucket,
+		Object:          ms.key(dst),
+		ContentType:     opts.ContentType,
+		CacheControl:    opts.CacheControl,
+		UserMetadata:    opts.Metadata,
+		ReplaceMetadata: true,
+	}
+
+	if info.Size <= maxCopyObjectSize {
+		_, err = ms.client.CopyObject(ms.context, dstOpts, srcOpts)
+	} else {
+		_, err = ms.client.ComposeObject(ms.context, dstOpts, srcOpts)
+	}
+	return err
 }
 
 func (ms *MinioStorage) Remove(name string) error {
-	return ms.client.RemoveObject(ms.context, ms.bucket, name, minio.RemoveObjectOptions{ForceDelete: true})
+	return ms.client.RemoveObject(ms.context, ms.bucket, ms.key(name), minio.RemoveObjectOptions{ForceDelete: true})
 }
 
-func (ms *MinioStorage) RemoveAll(path string) error {
-	for object := range ms.client.ListObjects(ms.context, ms.bucket, minio.ListObjectsOptions{
-		Prefix:    path,
-		Recursive: true,
-	}) {
-		if object.Err != nil {
-			return object.Err
+func (ms *MinioStorage) RemoveAll(path string) (int, error) {
+	var (
+		listed  int
+		listErr error
+	)
+
+	// RemoveObjects may stop reading before the listing ends, so cancel the
+	// lister and drain it rather than leaving it blocked on a send.
+	ctx, cancel := context.WithCancel(ms.context)
+	defer cancel()
+
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objects)
+		for object := range ms.client.ListObjects(ctx, ms.bucket, minio.ListObjectsOptions{
+			Prefix:    ms.key(path),
+			Recursive: true,
+		}) {
+			if ctx.Err() != nil {
+				break
+			}
+			if object.Err != nil {
+				listErr = object.Err
+				return
+			}
+			select {
+			case objects <- object:
+				listed++
+			case <-ctx.Done():
+			}
 		}
-		if err := ms.client.RemoveObject(ms.context, ms.bucket, object.Key, minio.RemoveObjectOptions{ForceDelete: true}); err != nil {
-			return nil
+		if ctx.Err() != nil {
+			listErr = fmt.Errorf("remove %s: stopped before every object was removed", path)
 		}
+	}()
+
+	var errs []error
+	for result := range ms.client.RemoveObjects(ctx, ms.bucket, objects, minio.RemoveObjectsOptions{}) {
+		errs = append(errs, fmt.Errorf("remove %s: %w", ms.name(result.ObjectName), result.Err))
 	}
-	return nil
+
+	cancel()
+	for range objects {
+	}
+
+	return listed - len(errs), errors.Join(append(errs, listErr)...)
 }
 
 func (ms *MinioStorage) Walk(root string, fn func(path string, err error) error) error {
 	for objects := range ms.client.ListObjects(ms.context, ms.bucket, minio.ListObjectsOptions{
-		Prefix:    root,
+		Prefix:    ms.key(root),
 		Recursive: true,
 	}) {
-		if err := fn(objects.Key, objects.Err); err != nil {
+		if err := fn(ms.name(objects.Key), objects.Err); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestMinioKey(t *testing.T) {
+	for _, tt := range []struct {
+		prefix, name, key string
+	}{
+		{prefix: "", name: "dists/trixie/Release", key: "dists/trixie/Release"},
+		{prefix: "", name: "pool/", key: "pool/"},
+		{prefix: "debian", name: "dists/trixie/Release", key: "debian/dists/trixie/Release"},
+		{prefix: "debian", name: "pool/trixie/", key: "debian/pool/trixie/"},
+		{prefix: "mirror/debian", name: "keys/faptly.gpg", key: "mirror/debian/keys/faptly.gpg"},
+	} {
+		t.Run(tt.prefix+":"+tt.name, func(t *testing.T) {
+			ms := &MinioStorage{prefix: tt.prefix}
+			if key := ms.key(tt.name); key != tt.key {
+				t.Errorf("key(%q) = %q, want %q", tt.name, key, tt.key)
+			}
+			if name := ms.name(tt.key); name != tt.name {
+				t.Errorf("name(%q) = %q, want %q", tt.key, name, tt.name)
+			}
+		})
+	}
+}
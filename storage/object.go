@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"path"
+	"strings"
+)
+
+type ObjectOptions struct {
+	ContentType  string
+	CacheControl string
+	Metadata     map[string]string
+}
+
+var nameContentTypes = map[string]string{
+	"Release.gpg": "application/pgp-signature",
+}
+
+var contentTypes = map[string]string{
+	".deb":  "application/vnd.debian.binary-package",
+	".udeb": "application/vnd.debian.binary-package",
+	".ddeb": "application/vnd.debian.binary-package",
+	".gz":   "application/gzip",
+	".xz":   "application/x-xz",
+	".bz2":  "application/x-bzip2",
+	".zst":  "application/zstd",
+	".gpg":  "application/pgp-keys",
+	".asc":  "application/pgp-keys",
+}
+
+func ContentType(name string) string {
+	if t, ok := nameContentTypes[path.Base(name)]; ok {
+		return t
+	}
+	if t, ok := contentTypes[strings.ToLower(path.Ext(name))]; ok {
+		return t
+	}
+	return "text/plain; charset=utf-8"
+}
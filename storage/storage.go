@@ -7,9 +7,10 @@ import (
 type Storage interface {
 	Exists(path string) bool
 	ReadFile(path string) ([]byte, error)
-	WriteFile(path string, data []byte) error
-	WriteFileWithReader(path string, data []byte, progress io.Reader) error
+	WriteFile(path string, data []byte, opts ObjectOptions) error
+	WriteFileWithReader(path string, data []byte, opts ObjectOptions, progress io.Reader) error
+	Copy(src, dst string, opts ObjectOptions) error
 	Remove(name string) error
-	RemoveAll(path string) error
+	RemoveAll(path string) (int, error)
 	Walk(root string, fn func(path string, err error) error) error
 }